@@ -19,6 +19,7 @@ func main() {
 	managers.Environment()
 
 	utils.Init(managers.Config.Environment == "development", managers.Config.WebURL)
+	utils.SetSignSecret(managers.Config.Secret)
 
 	numCPU := runtime.NumCPU()
 	runtime.GOMAXPROCS(numCPU - 1)
@@ -43,6 +44,11 @@ func main() {
 
 	wg.Wait()
 
+	managers.InitMailer()
+	managers.InitSMS()
+	managers.InitJWT()
+	managers.InitPasswordPolicy()
+
 	// 初始化基础数据（权限、角色等）
 	models.SeedDatabase()
 
@@ -32,6 +32,10 @@ func InitDB(wg *sync.WaitGroup) {
 		panic(err)
 	}
 
+	if err := registerTenantScope(DB); err != nil {
+		panic(err)
+	}
+
 	if Config.PG.URL == "" {
 		DB.AutoMigrate(&MakerSequence{})
 	}
@@ -1,6 +1,7 @@
 package managers
 
 import (
+	"crypto/rand"
 	"flag"
 	"log/slog"
 	"os"
@@ -15,17 +16,28 @@ var (
 )
 
 type BaseConfig struct {
-	Version     string    `toml:"version"`
-	Environment string    `toml:"environment"`
-	Port        int       `toml:"port" default:"80"`
-	HTTPSPort   int       `toml:"https_port" default:"443"`
-	WebURL      string    `toml:"webURL"`
-	ServerURL   string    `toml:"serverURL"`
-	Domain      string    `toml:"domain"`
-	PG          DBConfig  `toml:"postgresql"`
-	Redis       DBConfig  `toml:"redis"`
-	MQ          DBConfig  `toml:"mq"`
-	OSS         OSSConfig `toml:"oss"`
+	Version     string               `toml:"version"`
+	Environment string               `toml:"environment"`
+	Port        int                  `toml:"port" default:"80"`
+	HTTPSPort   int                  `toml:"https_port" default:"443"`
+	WebURL      string               `toml:"webURL"`
+	ServerURL   string               `toml:"serverURL"`
+	Domain      string               `toml:"domain"`
+	Secret      string               `toml:"secret"`
+	PG          DBConfig             `toml:"postgresql"`
+	Redis       DBConfig             `toml:"redis"`
+	MQ          DBConfig             `toml:"mq"`
+	OSS         OSSConfig            `toml:"oss"`
+	Mail        MailConfig           `toml:"mail"`
+	JWT         JWTConfig            `toml:"jwt"`
+	OIDC        []OIDCProviderConfig `toml:"oidc"`
+	Login       LoginConfig          `toml:"login"`
+	Password    PasswordConfig       `toml:"password"`
+	Account     AccountConfig        `toml:"account"`
+	Register    RegisterConfig       `toml:"register"`
+	Challenge   ChallengeConfig      `toml:"challenge"`
+	MagicLink   MagicLinkConfig      `toml:"magicLink"`
+	SMS         SMSConfig            `toml:"sms"`
 }
 
 type DBConfig struct {
@@ -36,6 +48,43 @@ type DBConfig struct {
 	DB       int    `toml:"db"`
 }
 
+// LoginConfig 登录限流，时间单位均为秒
+type LoginConfig struct {
+	IPLimit          int64 `toml:"ipLimit"`
+	IPWindow         int   `toml:"ipWindow"`
+	FreeAttempts     int64 `toml:"freeAttempts"`
+	BackoffBase      int   `toml:"backoffBase"`
+	BackoffMax       int   `toml:"backoffMax"`
+	LockoutThreshold int64 `toml:"lockoutThreshold"`
+	LockoutDuration  int   `toml:"lockoutDuration"`
+	FailureWindow    int   `toml:"failureWindow"`
+}
+
+type AccountConfig struct {
+	DeletionGraceDays int `toml:"deletionGraceDays"`
+}
+
+// RegisterConfig 注册方式：open 开放注册，invite 仅限邀请码，domain 仅限指定邮箱域名（持邀请码也可注册）
+type RegisterConfig struct {
+	Mode           string   `toml:"mode"`
+	AllowedDomains []string `toml:"allowedDomains"`
+}
+
+// ChallengeConfig 注册、登录前的工作量证明，难度为哈希开头需要为 0 的比特数
+type ChallengeConfig struct {
+	Enabled       bool `toml:"enabled"`
+	Difficulty    int  `toml:"difficulty"`
+	MaxDifficulty int  `toml:"maxDifficulty"`
+	Life          int  `toml:"life"`
+	FailureWindow int  `toml:"failureWindow"`
+}
+
+// MagicLinkConfig 通过邮件链接免密登录，Life 为链接有效秒数
+type MagicLinkConfig struct {
+	Enabled bool `toml:"enabled"`
+	Life    int  `toml:"life"`
+}
+
 func init() {
 	flag.StringVar(&configFile, "c", "configurations/dev.toml", "config file of binran")
 }
@@ -59,4 +108,67 @@ func Environment() {
 	if Config.ServerURL == "" {
 		Config.ServerURL = "http://localhost:" + strconv.Itoa(Config.Port)
 	}
+
+	if Config.Secret == "" {
+		Config.Secret = rand.Text()
+		slog.Warn("No secret configured, signed links will not survive a restart")
+	}
+
+	loginDefaults(&Config.Login)
+
+	if Config.Register.Mode == "" {
+		Config.Register.Mode = "open"
+	}
+
+	challengeDefaults(&Config.Challenge)
+
+	if Config.Account.DeletionGraceDays <= 0 {
+		Config.Account.DeletionGraceDays = 14
+	}
+
+	if Config.MagicLink.Life <= 0 {
+		Config.MagicLink.Life = 600
+	}
+}
+
+func loginDefaults(login *LoginConfig) {
+	if login.IPLimit <= 0 {
+		login.IPLimit = 5
+	}
+	if login.IPWindow <= 0 {
+		login.IPWindow = 3600
+	}
+	if login.FreeAttempts <= 0 {
+		login.FreeAttempts = 3
+	}
+	if login.BackoffBase <= 0 {
+		login.BackoffBase = 1
+	}
+	if login.BackoffMax <= 0 {
+		login.BackoffMax = 300
+	}
+	if login.LockoutThreshold <= 0 {
+		login.LockoutThreshold = 10
+	}
+	if login.LockoutDuration <= 0 {
+		login.LockoutDuration = 900
+	}
+	if login.FailureWindow <= 0 {
+		login.FailureWindow = 3600
+	}
+}
+
+func challengeDefaults(challenge *ChallengeConfig) {
+	if challenge.Difficulty <= 0 {
+		challenge.Difficulty = 18
+	}
+	if challenge.MaxDifficulty < challenge.Difficulty {
+		challenge.MaxDifficulty = challenge.Difficulty + 6
+	}
+	if challenge.Life <= 0 {
+		challenge.Life = 120
+	}
+	if challenge.FailureWindow <= 0 {
+		challenge.FailureWindow = 3600
+	}
 }
@@ -0,0 +1,103 @@
+package managers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"os"
+	"server-go/utils"
+	"time"
+)
+
+type JWTConfig struct {
+	Enabled     bool   `toml:"enabled"`
+	Algorithm   string `toml:"algorithm"`
+	KeyFile     string `toml:"keyFile"`
+	AccessLife  int    `toml:"accessLife"`
+	RefreshLife int    `toml:"refreshLife"`
+}
+
+var (
+	JWTKey   crypto.Signer
+	JWTKeyID string
+)
+
+func InitJWT() {
+	if Config.JWT.AccessLife <= 0 {
+		Config.JWT.AccessLife = 300
+	}
+	if Config.JWT.RefreshLife <= 0 {
+		Config.JWT.RefreshLife = 30 * 24 * 3600
+	}
+
+	var err error
+	if Config.JWT.KeyFile != "" {
+		JWTKey, err = loadJWTKey(Config.JWT.KeyFile)
+	} else {
+		// 未配置密钥文件时生成临时密钥，重启后已签发的令牌全部失效
+		slog.Warn("No jwt key file configured, using an ephemeral key")
+		if Config.JWT.Algorithm == utils.JWTAlgES256 {
+			JWTKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		} else {
+			_, JWTKey, err = ed25519.GenerateKey(rand.Reader)
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	alg, err := utils.JWTAlgorithm(JWTKey)
+	if err != nil {
+		panic(err)
+	}
+
+	JWTKeyID = utils.JWTKeyID(JWTKey.Public())
+
+	slog.Info("JWT key loaded", "alg", alg, "kid", JWTKeyID, "enabled", Config.JWT.Enabled)
+}
+
+// JWTPublicKey 按 kid 查找验签公钥
+func JWTPublicKey(kid string) crypto.PublicKey {
+	if kid != JWTKeyID {
+		return nil
+	}
+	return JWTKey.Public()
+}
+
+func AccessTokenLife() time.Duration {
+	return time.Duration(Config.JWT.AccessLife) * time.Second
+}
+
+func RefreshTokenLife() time.Duration {
+	return time.Duration(Config.JWT.RefreshLife) * time.Second
+}
+
+func loadJWTKey(file string) (crypto.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt key file is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("jwt key is not a signing key")
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,85 @@
+package managers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MailConfig struct {
+	Driver   string `toml:"driver"`
+	Dir      string `toml:"dir"`
+	From     string `toml:"from"`
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// Mailer 邮件发送接口，开发环境写入本地目录，生产环境走 SMTP
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+var Mail Mailer
+
+func InitMailer() {
+	switch Config.Mail.Driver {
+	case "smtp":
+		Mail = &SMTPMailer{
+			Addr: net.JoinHostPort(Config.Mail.Host, strconv.Itoa(Config.Mail.Port)),
+			From: Config.Mail.From,
+			Auth: smtp.PlainAuth("", Config.Mail.Username, Config.Mail.Password, Config.Mail.Host),
+		}
+	default:
+		dir := Config.Mail.Dir
+		if dir == "" {
+			dir = "mails"
+		}
+		Mail = &FileMailer{Dir: dir, From: Config.Mail.From}
+	}
+
+	slog.Info("Mailer initialized", "driver", Config.Mail.Driver)
+}
+
+// FileMailer 把邮件以 .eml 文件写入本地目录
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strings.NewReplacer("@", "_at_", "/", "_").Replace(to) + ".eml"
+
+	slog.Info("Mail written", "to", to, "subject", subject, "file", name)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), buildMail(m.From, to, subject, body), 0o644)
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, buildMail(m.From, to, subject, body))
+}
+
+func buildMail(from string, to string, subject string, body string) []byte {
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		from, to, subject, time.Now().Format(time.RFC1123Z), body))
+}
@@ -0,0 +1,244 @@
+package managers
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"server-go/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OIDCProviderConfig struct {
+	Name         string   `toml:"name"`
+	Issuer       string   `toml:"issuer"`
+	ClientID     string   `toml:"clientId"`
+	ClientSecret string   `toml:"clientSecret"`
+	Scopes       []string `toml:"scopes"`
+}
+
+// OIDCProvider 上游 OpenID Connect 身份提供方。
+// 端点全部通过 issuer 的发现文档获取，指向本地的模拟 issuer 即可联调。
+type OIDCProvider struct {
+	OIDCProviderConfig
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var (
+	OIDCProviders = map[string]*OIDCProvider{}
+	oidcClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+var ErrOIDCProvider = errors.New("identity provider error")
+
+func InitOIDC() {
+	for _, provider := range Config.OIDC {
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "profile", "email"}
+		}
+		OIDCProviders[provider.Name] = &OIDCProvider{OIDCProviderConfig: provider}
+		slog.Info("OIDC provider registered", "name", provider.Name, "issuer", provider.Issuer)
+	}
+}
+
+// RedirectURL 回调地址
+func (p *OIDCProvider) RedirectURL() string {
+	return Config.ServerURL + "/account/oidc/callback"
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", ErrOIDCProvider, endpoint, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+
+	if discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch %q", ErrOIDCProvider, discovery.Issuer)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// AuthorizationURL 拼接跳转到身份提供方的授权地址
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state string, nonce string, challenge string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL()},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 用授权码换取并校验 ID Token，返回其中的声明
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, verifier string, nonce string) (map[string]interface{}, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL()},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := oidcClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned %d %s", ErrOIDCProvider, res.StatusCode, token.Error)
+	}
+
+	_, claims, err := utils.JWTVerify(token.IDToken, func(kid string) crypto.PublicKey {
+		return p.key(ctx, discovery.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCProvider, iss)
+	}
+
+	if !oidcAudience(claims["aud"], p.ClientID) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrOIDCProvider)
+	}
+
+	if claimed, _ := claims["nonce"].(string); claimed != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCProvider)
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrOIDCProvider)
+	}
+
+	return claims, nil
+}
+
+// key 按 kid 查找签名公钥，找不到时刷新 JWKS（最多每分钟一次）
+func (p *OIDCProvider) key(ctx context.Context, jwksURI string, kid string) crypto.PublicKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+
+	if time.Since(p.keysAt) < time.Minute {
+		return nil
+	}
+
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &jwks); err != nil {
+		slog.Error("Failed to fetch jwks", "provider", p.Name, "err", err)
+		return nil
+	}
+
+	p.keys = map[string]crypto.PublicKey{}
+	p.keysAt = time.Now()
+	for _, jwk := range jwks.Keys {
+		id, _ := jwk["kid"].(string)
+		if key, err := utils.ParseJWK(jwk); err == nil {
+			p.keys[id] = key
+		}
+	}
+
+	return p.keys[kid]
+}
+
+func oidcAudience(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, item := range value {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package managers
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"server-go/utils"
+	"strings"
+)
+
+type PasswordConfig struct {
+	MinLength     int    `toml:"minLength"`
+	MaxLength     int    `toml:"maxLength"`
+	RequireUpper  bool   `toml:"requireUpper"`
+	RequireLower  bool   `toml:"requireLower"`
+	RequireDigit  bool   `toml:"requireDigit"`
+	RequireSymbol bool   `toml:"requireSymbol"`
+	DenyListFile  string `toml:"denyListFile"`
+	History       int    `toml:"history"`
+	MaxAgeDays    int    `toml:"maxAgeDays"`
+	HashMemory    uint32 `toml:"hashMemory"`
+	HashTime      uint32 `toml:"hashTime"`
+	HashThreads   uint8  `toml:"hashThreads"`
+}
+
+// PasswordDenyList 常见弱密码，统一按小写保存
+var PasswordDenyList = map[string]struct{}{}
+
+func InitPasswordPolicy() {
+	if Config.Password.MinLength <= 0 {
+		Config.Password.MinLength = 8
+	}
+	if Config.Password.MaxLength <= 0 {
+		Config.Password.MaxLength = 128
+	}
+
+	if Config.Password.HashMemory == 0 {
+		Config.Password.HashMemory = utils.DefaultArgon2Params.Memory
+	}
+	if Config.Password.HashTime == 0 {
+		Config.Password.HashTime = utils.DefaultArgon2Params.Time
+	}
+	if Config.Password.HashThreads == 0 {
+		Config.Password.HashThreads = utils.DefaultArgon2Params.Threads
+	}
+
+	if Config.Password.DenyListFile == "" {
+		return
+	}
+
+	file, err := os.Open(Config.Password.DenyListFile)
+	if err != nil {
+		slog.Error("Failed to open password deny list", "file", Config.Password.DenyListFile, "err", err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		PasswordDenyList[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Error("Failed to read password deny list", "file", Config.Password.DenyListFile, "err", err)
+	}
+
+	slog.Info("Password deny list loaded", "entries", len(PasswordDenyList))
+}
+
+// PasswordHashParams 当前使用的 Argon2id 参数，调整后旧哈希会在下次登录时升级
+func PasswordHashParams() utils.Argon2Params {
+	return utils.Argon2Params{
+		Memory:  Config.Password.HashMemory,
+		Time:    Config.Password.HashTime,
+		Threads: Config.Password.HashThreads,
+	}
+}
@@ -11,13 +11,45 @@ import (
 var Redis *redis.Client
 
 const (
-	ACCOUNT = "A"
-	IP      = "I"
-	TOKEN   = "T"
+	ACCOUNT  = "A"
+	IP       = "I"
+	TOKEN    = "T"
+	SESSIONS = "S"
 )
 
 const (
-	IPLIMIT = "IP"
+	IPLIMIT       = "IP"
+	PENDINGLOGIN  = "PL"
+	TOTPSETUP     = "TS"
+	TOTPUSED      = "TU"
+	WAREG         = "WR"
+	WALOGIN       = "WL"
+	EMAILVERIFY   = "EV"
+	PWRESET       = "PR"
+	RESETIPLIMIT  = "RI"
+	RESETLIMIT    = "RA"
+	REFRESH       = "RT"
+	REFRESHFAMILY = "RF"
+	REFRESHUSER   = "RU"
+	OAUTHREQUEST  = "OR"
+	OAUTHCODE     = "OC"
+	OIDCSTATE     = "OS"
+	OIDCLOGIN     = "OL"
+	LOGINFAIL     = "LF"
+	LOGINWAIT     = "LW"
+	LOGINLOCK     = "LL"
+	ACCOUNTPURGE  = "AP"
+	POWUSED       = "PU"
+	POWFAIL       = "PF"
+	USERDISABLED  = "UD"
+	MAGICLINK     = "ML"
+	MAGICIPLIMIT  = "MI"
+	MAGICLIMIT    = "MA"
+	MAGICLOGIN    = "MG"
+	SMSCODE       = "SO"
+	SMSCOOLDOWN   = "SC"
+	SMSIPLIMIT    = "SI"
+	PERMCACHE     = "PC"
 )
 
 const (
@@ -0,0 +1,123 @@
+package managers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// SMSConfig 短信验证码，时间单位均为秒。CountryCode 为不带 + 的默认国家码，用于补全本地号码
+type SMSConfig struct {
+	Driver       string `toml:"driver"`
+	Dir          string `toml:"dir"`
+	WebhookURL   string `toml:"webhookURL"`
+	WebhookToken string `toml:"webhookToken"`
+	CountryCode  string `toml:"countryCode"`
+	LoginEnabled bool   `toml:"loginEnabled"`
+	CodeLife     int    `toml:"codeLife"`
+	Cooldown     int    `toml:"cooldown"`
+	MaxAttempts  int64  `toml:"maxAttempts"`
+}
+
+// SMSSender 短信发送接口，开发环境输出到日志或本地目录，生产环境转发给短信网关
+type SMSSender interface {
+	Send(ctx context.Context, to string, message string) error
+}
+
+var SMS SMSSender
+
+func InitSMS() {
+	config := &Config.SMS
+
+	if config.CodeLife <= 0 {
+		config.CodeLife = 300
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 60
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+
+	switch config.Driver {
+	case "webhook":
+		SMS = &WebhookSMS{URL: config.WebhookURL, Token: config.WebhookToken, Client: &http.Client{Timeout: 10 * time.Second}}
+	case "file":
+		dir := config.Dir
+		if dir == "" {
+			dir = "sms"
+		}
+		SMS = &FileSMS{Dir: dir}
+	default:
+		SMS = &ConsoleSMS{}
+	}
+
+	slog.Info("SMS sender initialized", "driver", config.Driver)
+}
+
+// ConsoleSMS 把短信内容写入日志
+type ConsoleSMS struct{}
+
+func (s *ConsoleSMS) Send(ctx context.Context, to string, message string) error {
+	slog.Info("SMS", "to", to, "message", message)
+	return nil
+}
+
+// FileSMS 把短信以文本文件写入本地目录
+type FileSMS struct {
+	Dir string
+}
+
+func (s *FileSMS) Send(ctx context.Context, to string, message string) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + to + ".txt"
+
+	slog.Info("SMS written", "to", to, "file", name)
+
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte("To: "+to+"\n\n"+message+"\n"), 0o644)
+}
+
+// WebhookSMS 以 JSON 形式把短信转发给网关，由网关对接具体的短信服务商
+type WebhookSMS struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (s *WebhookSMS) Send(ctx context.Context, to string, message string) error {
+	payload, err := json.Marshal(map[string]string{"to": to, "message": message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway returned %s", res.Status)
+	}
+
+	return nil
+}
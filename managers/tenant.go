@@ -0,0 +1,81 @@
+package managers
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 多租户隔离：context 中带有组织 ID 时，所有带 OrganizationID 字段的模型
+// 查询、更新、删除自动加上 organization_id 条件，创建时自动填入组织 ID。
+// 使用方式为 DB.WithContext(WithTenant(ctx, orgID))
+//
+// 目前按组织隔离的模型只有 OrganizationMember、OrganizationRole、OrganizationInvitation。
+// User、Role、Permission 等其余模型是全局的，不受隔离；组织接口只能经由成员关系读取用户，
+// 把用户拉进组织也只能发出邀请，由用户本人接受
+
+type tenantKey struct{}
+
+// WithTenant 返回带有组织 ID 的 context
+func WithTenant(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, organizationID)
+}
+
+// TenantFromContext 读取 context 中的组织 ID
+func TenantFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(tenantKey{}).(uint)
+	return id, ok
+}
+
+func tenantField(db *gorm.DB) (string, uint, bool) {
+	id, ok := TenantFromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return "", 0, false
+	}
+
+	field := db.Statement.Schema.LookUpField("OrganizationID")
+	if field == nil {
+		return "", 0, false
+	}
+	return field.DBName, id, true
+}
+
+func tenantScope(db *gorm.DB) {
+	column, id, ok := tenantField(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: id},
+	}})
+}
+
+func tenantCreate(db *gorm.DB) {
+	if _, id, ok := tenantField(db); ok {
+		db.Statement.SetColumn("OrganizationID", id, true)
+	}
+}
+
+// registerTenantScope 注册多租户隔离的回调
+func registerTenantScope(db *gorm.DB) error {
+	callback := db.Callback()
+
+	if err := callback.Create().Before("gorm:create").Register("tenant:create", tenantCreate); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("tenant:query", tenantScope); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("tenant:update", tenantScope); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("tenant:delete", tenantScope); err != nil {
+		return err
+	}
+	return callback.Row().Before("gorm:row").Register("tenant:row", tenantScope)
+}
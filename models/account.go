@@ -3,10 +3,12 @@ package models
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"log/slog"
 	"net/http"
 	"server-go/managers"
 	"server-go/utils"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -14,31 +16,48 @@ import (
 )
 
 type User struct {
-	ID          uint           `gorm:"primary_key" json:"id"`
-	CreatedAt   time.Time      `json:"-"`
-	UpdatedAt   time.Time      `json:"-"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	Username    string         `gorm:"size:30;unique;not null" json:"username"`
-	Password    []byte         `json:"-"`
-	Salt        []byte         `json:"-"`
-	Name        string         `gorm:"size:50" json:"name,omitempty"`
-	AvatarPath  string         `gorm:"size:255;column:avatar" json:"-"`
-	PhoneNumber string         `gorm:"size:20" json:"phoneNumber,omitempty"`
-	Email       string         `gorm:"size:100" json:"email,omitempty"`
-	Sex         uint8          `gorm:"default:0;not null" json:"sex,omitempty"`
-	Role        []Role         `gorm:"many2many:user_roles;" json:"roles,omitempty"`
-	Permission  []Permission   `gorm:"many2many:user_permissions;" json:"permissions,omitempty"`
+	ID                  uint           `gorm:"primary_key" json:"id"`
+	CreatedAt           time.Time      `json:"-"`
+	UpdatedAt           time.Time      `json:"-"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+	Username            string         `gorm:"size:30;unique;not null" json:"username"`
+	Password            []byte         `json:"-"`
+	Salt                []byte         `json:"-"`
+	Name                string         `gorm:"size:50" json:"name,omitempty"`
+	AvatarPath          string         `gorm:"size:255;column:avatar" json:"-"`
+	PhoneNumber         string         `gorm:"size:20" json:"phoneNumber,omitempty"`
+	PhoneVerified       bool           `gorm:"default:false;not null" json:"phoneVerified"`
+	Email               string         `gorm:"size:100" json:"email,omitempty"`
+	EmailVerified       bool           `gorm:"default:false;not null" json:"emailVerified"`
+	Department          string         `gorm:"size:64;index" json:"department,omitempty"`
+	Sex                 uint8          `gorm:"default:0;not null" json:"sex,omitempty"`
+	TOTPSecret          string         `gorm:"size:64;column:totp_secret" json:"-"`
+	TOTPEnabled         bool           `gorm:"default:false;not null;column:totp_enabled" json:"totpEnabled"`
+	PasswordChangedAt   *time.Time     `json:"-"`
+	DeletionRequestedAt *time.Time     `json:"deletionRequestedAt,omitempty"`
+	InviteID            *uint          `json:"-"`
+	EmailPending        bool           `gorm:"default:false;not null" json:"emailPending,omitempty"`
+	SuspendedAt         *time.Time     `json:"suspendedAt,omitempty"`
+	SuspendReason       string         `gorm:"size:255" json:"suspendReason,omitempty"`
+	MustChangePassword  bool           `gorm:"default:false;not null" json:"mustChangePassword,omitempty"`
+	PurgedAt            *time.Time     `json:"-"`
+	Role                []Role         `gorm:"many2many:user_roles;" json:"roles,omitempty"`
+	Permission          []Permission   `gorm:"many2many:user_permissions;" json:"permissions,omitempty"`
+	InheritedRoles      []Role         `gorm:"-" json:"inheritedRoles,omitempty"`
 }
 
 type Role struct {
-	ID          uint           `gorm:"primary_key" json:"id"`
-	CreatedAt   time.Time      `json:"-"`
-	UpdatedAt   time.Time      `json:"-"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	Name        string         `gorm:"size:30;unique;not null" json:"name"`
-	Description string         `gorm:"size:255;" json:"description"`
-	User        []User         `gorm:"many2many:user_roles;"`
-	Permission  []Permission   `gorm:"many2many:role_permissions;" json:"permissions,omitempty"`
+	ID               uint           `gorm:"primary_key" json:"id"`
+	CreatedAt        time.Time      `json:"-"`
+	UpdatedAt        time.Time      `json:"-"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	Name             string         `gorm:"size:30;unique;not null" json:"name"`
+	Description      string         `gorm:"size:255;" json:"description"`
+	RequireTwoFactor bool           `gorm:"default:false;not null" json:"requireTwoFactor"`
+	ParentID         *uint          `gorm:"index" json:"parentId,omitempty"`
+	Children         []*Role        `gorm:"-" json:"children,omitempty"`
+	User             []User         `gorm:"many2many:user_roles;"`
+	Permission       []Permission   `gorm:"many2many:role_permissions;" json:"permissions,omitempty"`
 }
 
 type Permission struct {
@@ -53,33 +72,20 @@ type Permission struct {
 }
 
 func AccountInit() {
-	managers.DB.AutoMigrate(&User{}, &Role{}, &Permission{})
+	managers.DB.AutoMigrate(&User{}, &Role{}, &Permission{}, &PermissionNamespace{})
+	PasswordPolicyInit()
+	LoginEventInit()
 }
 
-// HasPermission 检查用户是否有指定权限
+// HasPermission 检查用户是否有指定权限，支持通配符和拒绝条目。
+// 需要多次检查时先调用 PermissionMatcher 编译一次
 func (user *User) HasPermission(permissionName string) bool {
-	// 检查直接权限
-	for _, perm := range user.Permission {
-		if perm.Name == permissionName {
-			return true
-		}
-	}
-
-	// 检查角色权限
-	for _, role := range user.Role {
-		for _, perm := range role.Permission {
-			if perm.Name == permissionName {
-				return true
-			}
-		}
-	}
-
-	return false
+	return user.PermissionMatcher().Match(permissionName)
 }
 
 // HasRole 检查用户是否有指定角色
 func (user *User) HasRole(roleName string) bool {
-	for _, role := range user.Role {
+	for _, role := range user.EffectiveRoles() {
 		if role.Name == roleName {
 			return true
 		}
@@ -87,9 +93,12 @@ func (user *User) HasRole(roleName string) bool {
 	return false
 }
 
-// LoadPermissions 加载用户的完整权限信息
+// LoadPermissions 加载用户的完整权限信息，包括继承的角色
 func (user *User) LoadPermissions() error {
-	return managers.DB.Preload("Role.Permission").Preload("Permission").First(user, user.ID).Error
+	if err := managers.DB.Preload("Role.Permission").Preload("Permission").First(user, user.ID).Error; err != nil {
+		return err
+	}
+	return user.LoadInheritedRoles()
 }
 
 // GetAvatarURL 获取用户头像URL
@@ -109,10 +118,59 @@ func (user *User) GetAvatarURL(ctx context.Context) string {
 }
 
 func (user *User) SetPassword(password string) {
-	user.Salt = utils.RandomBytes(32)
-	user.Password = PasswordMaker(password, user.Salt)
+	user.Password = []byte(utils.HashPassword(password, managers.PasswordHashParams()))
+	user.Salt = nil
+	now := time.Now()
+	user.PasswordChangedAt = &now
 }
 
+// CheckPassword 常量时间校验密码，返回是否需要用当前参数重新计算哈希。
+// 没有密码的用户同样计算一次哈希，避免通过响应时间判断账号是否存在。
+func (user *User) CheckPassword(password string) (ok bool, rehash bool) {
+	if len(user.Password) == 0 {
+		utils.VerifyPassword(password, dummyPasswordHash(), managers.PasswordHashParams())
+		return false, false
+	}
+	return verifyPasswordHash(password, user.Password, user.Salt)
+}
+
+// RehashPassword 旧格式或旧参数的哈希在登录成功后透明升级，不改变密码修改时间
+func (user *User) RehashPassword(password string) error {
+	user.Password = []byte(utils.HashPassword(password, managers.PasswordHashParams()))
+	user.Salt = nil
+
+	return managers.DB.Model(user).Updates(map[string]interface{}{
+		"password": user.Password,
+		"salt":     user.Salt,
+	}).Error
+}
+
+// verifyPasswordHash 以 $ 开头的是自描述的 PHC 格式，否则是早期的 PBKDF2 哈希
+func verifyPasswordHash(password string, hash []byte, salt []byte) (ok bool, rehash bool) {
+	if len(hash) > 0 && hash[0] == '$' {
+		ok, rehash, err := utils.VerifyPassword(password, string(hash), managers.PasswordHashParams())
+		if err != nil {
+			slog.Error("Failed to verify password hash", "err", err)
+		}
+		return ok, rehash
+	}
+
+	return subtle.ConstantTimeCompare(hash, PasswordMaker(password, salt)) == 1, true
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash = utils.HashPassword(utils.RandomURLBase64(16), managers.PasswordHashParams())
+	})
+	return dummyHash
+}
+
+// PasswordMaker 早期使用的 PBKDF2-SHA256 哈希，只用于校验尚未升级的密码
 func PasswordMaker(password string, salt []byte) []byte {
 	return pbkdf2.Key([]byte(password), salt, 4096, 128, sha256.New)
 }
@@ -120,11 +178,27 @@ func PasswordMaker(password string, salt []byte) []byte {
 func UpdateToken(w http.ResponseWriter, r *http.Request, userID string, ip string) error {
 	token := TokenMaker()
 
-	if err := utils.HSetAndExpireNonatomic(managers.Redis, r.Context(), managers.TOKEN+token, map[string]interface{}{"id": userID}, managers.UserTokenLife); err != nil {
+	now := time.Now().Unix()
+	session := map[string]interface{}{
+		"id":      userID,
+		"ip":      ip,
+		"ua":      r.UserAgent(),
+		"created": now,
+		"seen":    now,
+	}
+
+	if err := utils.HSetAndExpireNonatomic(managers.Redis, r.Context(), managers.TOKEN+token, session, managers.UserTokenLife); err != nil {
 		slog.Error("Set token cache failed.", "err", err)
 		return err
 	}
 
+	// 记录到用户的会话索引，便于一次性吊销
+	if err := managers.Redis.SAdd(r.Context(), managers.SESSIONS+userID, token).Err(); err != nil {
+		slog.Error("Set session index failed.", "err", err)
+		return err
+	}
+	managers.Redis.Expire(r.Context(), managers.SESSIONS+userID, managers.UserTokenLife)
+
 	SetCookie(w, r, &http.Cookie{Name: "token", Value: token, Path: "/", HttpOnly: true, MaxAge: int(managers.UserTokenLife.Seconds())})
 	SetCookie(w, r, &http.Cookie{Name: "auth_status", Value: "1", Path: "/", HttpOnly: false, MaxAge: int(managers.UserTokenLife.Seconds())})
 
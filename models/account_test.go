@@ -0,0 +1,64 @@
+package models
+
+import (
+	"server-go/managers"
+	"server-go/utils"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPasswordHash(t *testing.T) {
+	managers.Config.Password.HashMemory = 1024
+	managers.Config.Password.HashTime = 1
+	managers.Config.Password.HashThreads = 1
+
+	salt := []byte("legacy-salt")
+	legacy := PasswordMaker("correct horse", salt)
+	current := []byte(utils.HashPassword("correct horse", managers.PasswordHashParams()))
+	outdated := []byte(utils.HashPassword("correct horse", utils.Argon2Params{Memory: 2048, Time: 1, Threads: 1}))
+
+	tests := []struct {
+		name     string
+		password string
+		hash     []byte
+		salt     []byte
+		ok       bool
+		rehash   bool
+	}{
+		{"current argon2id", "correct horse", current, nil, true, false},
+		{"argon2id wrong password", "battery staple", current, nil, false, false},
+		{"argon2id outdated parameters", "correct horse", outdated, nil, true, true},
+		{"legacy PBKDF2 is upgraded", "correct horse", legacy, salt, true, true},
+		{"legacy PBKDF2 wrong password", "battery staple", legacy, salt, false, true},
+		{"legacy PBKDF2 wrong salt", "correct horse", legacy, []byte("other-salt"), false, true},
+		{"malformed PHC string", "correct horse", []byte("$argon2id$broken"), nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := verifyPasswordHash(tt.password, tt.hash, tt.salt)
+			if ok != tt.ok || (ok && rehash != tt.rehash) {
+				t.Errorf("verifyPasswordHash = %v, %v, want %v, %v", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestSetPasswordReplacesLegacyHash(t *testing.T) {
+	managers.Config.Password.HashMemory = 1024
+	managers.Config.Password.HashTime = 1
+	managers.Config.Password.HashThreads = 1
+
+	user := User{Password: PasswordMaker("old", []byte("legacy-salt")), Salt: []byte("legacy-salt")}
+	user.SetPassword("correct horse")
+
+	if user.Salt != nil || !strings.HasPrefix(string(user.Password), "$argon2id$") || user.PasswordChangedAt == nil {
+		t.Fatalf("SetPassword left password = %q, salt = %q", user.Password, user.Salt)
+	}
+	if ok, rehash := user.CheckPassword("correct horse"); !ok || rehash {
+		t.Errorf("CheckPassword = %v, %v, want true, false", ok, rehash)
+	}
+	if ok, _ := user.CheckPassword("old"); ok {
+		t.Error("CheckPassword accepted the previous password")
+	}
+}
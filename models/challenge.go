@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"server-go/managers"
+	"server-go/utils"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ChallengeLogin    = "login"
+	ChallengeRegister = "register"
+)
+
+var ErrChallengeFailed = errors.New("proof-of-work challenge is missing, invalid or already used")
+
+// Challenge 下发给客户端的工作量证明题目
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// ChallengeDifficulty 基础难度加上该 IP 近期的失败次数
+func ChallengeDifficulty(ctx context.Context, ip string) (int, error) {
+	config := managers.Config.Challenge
+
+	failures, err := managers.Redis.Get(ctx, managers.POWFAIL+ip).Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	return min(config.Difficulty+failures, config.MaxDifficulty), nil
+}
+
+// NewChallenge 签发绑定了用途和 IP 的题目，服务端不需要保存状态
+func NewChallenge(ctx context.Context, action string, ip string) (*Challenge, error) {
+	difficulty, err := ChallengeDifficulty(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	life := time.Duration(managers.Config.Challenge.Life) * time.Second
+
+	return &Challenge{
+		Challenge:  utils.SignToken(life, "pow", action, ip, strconv.Itoa(difficulty), utils.RandomURLBase64(12)),
+		Difficulty: difficulty,
+		ExpiresAt:  time.Now().Add(life),
+	}, nil
+}
+
+// VerifyChallenge 校验签名、用途、IP 和答案，每道题只能使用一次
+func VerifyChallenge(ctx context.Context, action string, ip string, challenge string, solution string) error {
+	if challenge == "" || solution == "" {
+		return ErrChallengeFailed
+	}
+
+	fields, err := utils.VerifyToken(challenge)
+	if err != nil || len(fields) != 5 || fields[0] != "pow" || fields[1] != action || fields[2] != ip {
+		return ErrChallengeFailed
+	}
+
+	difficulty, err := strconv.Atoi(fields[3])
+	if err != nil || utils.PoWLeadingZeros(challenge, solution) < difficulty {
+		return ErrChallengeFailed
+	}
+
+	sum := sha256.Sum256([]byte(challenge))
+	life := time.Duration(managers.Config.Challenge.Life) * time.Second
+	fresh, err := managers.Redis.SetNX(ctx, managers.POWUSED+hex.EncodeToString(sum[:]), 1, life).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrChallengeFailed
+	}
+
+	return nil
+}
+
+// RecordChallengeFailure 记录 IP 的一次失败，之后签发的题目难度随之提高
+func RecordChallengeFailure(ctx context.Context, ip string) error {
+	_, err := utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.POWFAIL+ip,
+		time.Duration(managers.Config.Challenge.FailureWindow)*time.Second)
+	return err
+}
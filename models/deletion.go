@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"server-go/managers"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const accountPurgeInterval = time.Hour
+
+// DeletionGracePeriod 申请注销后到真正清除数据之间的等待时间
+func DeletionGracePeriod() time.Duration {
+	return time.Duration(managers.Config.Account.DeletionGraceDays) * 24 * time.Hour
+}
+
+// ScheduleDeletion 申请注销账号并吊销所有登录凭据，宽限期内可以撤销
+func ScheduleDeletion(ctx context.Context, user *User) error {
+	now := time.Now()
+	if err := managers.DB.Model(user).Update("deletion_requested_at", now).Error; err != nil {
+		return err
+	}
+	user.DeletionRequestedAt = &now
+
+	return RevokeAllTokens(ctx, managers.IDToString(user.ID))
+}
+
+// CancelDeletion 撤销注销申请
+func CancelDeletion(user *User) error {
+	user.DeletionRequestedAt = nil
+	return managers.DB.Model(user).Update("deletion_requested_at", nil).Error
+}
+
+// StartAccountPurger 定期清除宽限期已过的账号，多实例部署时通过 Redis 锁保证只有一个实例执行
+func StartAccountPurger() {
+	go func() {
+		ticker := time.NewTicker(accountPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			ctx := context.Background()
+			ok, err := managers.Redis.SetNX(ctx, managers.ACCOUNTPURGE, 1, accountPurgeInterval-time.Minute).Result()
+			if err != nil {
+				slog.Error("Failed to acquire purge lock", "err", err)
+			} else if ok {
+				PurgeDeletedAccounts(ctx)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// PurgeDeletedAccounts 清除所有宽限期已过的账号，包括期间被管理员软删除、但尚未清除的账号
+func PurgeDeletedAccounts(ctx context.Context) {
+	var users []User
+	if err := managers.DB.Unscoped().
+		Where("deletion_requested_at IS NOT NULL AND deletion_requested_at <= ? AND purged_at IS NULL", time.Now().Add(-DeletionGracePeriod())).
+		Find(&users).Error; err != nil {
+		slog.Error("Failed to find accounts to purge", "err", err)
+		return
+	}
+
+	for i := range users {
+		if err := PurgeAccount(ctx, &users[i]); err != nil {
+			slog.Error("Failed to purge account", "id", users[i].ID, "err", err)
+			continue
+		}
+		slog.Info("Account purged", "id", users[i].ID)
+	}
+}
+
+// PurgeAccount 吊销所有凭据，删除头像和关联数据，抹去个人信息后软删除。
+// 保留匿名化的行，避免外键和审计记录失效。
+func PurgeAccount(ctx context.Context, user *User) error {
+	userID := managers.IDToString(user.ID)
+
+	if err := RevokeAllTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := setUserDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+
+	if err := deleteAvatars(ctx, user); err != nil {
+		return err
+	}
+
+	if err := managers.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&RecoveryCode{},
+			&WebAuthnCredential{},
+			&ExternalIdentity{},
+			&OAuthConsent{},
+			&PasswordHistory{},
+			&PersonalAccessToken{},
+			&LoginEvent{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := deleteUserMemberships(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Association("Role").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Association("Permission").Clear(); err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(user).Updates(map[string]interface{}{
+			"username":              "deleted-" + userID,
+			"password":              nil,
+			"salt":                  nil,
+			"name":                  "",
+			"avatar":                "",
+			"phone_number":          "",
+			"phone_verified":        false,
+			"email":                 "",
+			"email_verified":        false,
+			"department":            "",
+			"sex":                   0,
+			"totp_secret":           "",
+			"totp_enabled":          false,
+			"password_changed_at":   nil,
+			"deletion_requested_at": nil,
+			"suspended_at":          nil,
+			"suspend_reason":        "",
+			"purged_at":             time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// 已被软删除的账号这里不会再改动 deleted_at
+		return tx.Delete(user).Error
+	}); err != nil {
+		return err
+	}
+
+	return InvalidatePermissions(ctx, userID)
+}
+
+// deleteAvatars 删除记录的头像以及上传过但未确认的头像
+func deleteAvatars(ctx context.Context, user *User) error {
+	bucket := managers.RustFSClient.Bucket
+
+	objects, err := managers.RustFSClient.Client.ListFiles(ctx, bucket, "avatar/"+managers.IDToString(user.ID)+".")
+	if err != nil {
+		return err
+	}
+
+	if user.AvatarPath != "" {
+		objects = append(objects, user.AvatarPath)
+	}
+
+	seen := map[string]bool{}
+	for _, object := range objects {
+		if seen[object] {
+			continue
+		}
+		seen[object] = true
+
+		if err := managers.RustFSClient.Client.DeleteFile(ctx, bucket, object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"log/slog"
+	"server-go/managers"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// UserDisabledChannel 广播账号停用状态变化的频道，消息内容为 "用户 ID:1" 或 "用户 ID:0"
+	UserDisabledChannel = "users:disabled"
+	// 全量重新加载的间隔，订阅断开期间错过的消息最多影响这么久
+	disabledReloadInterval = 30 * time.Second
+)
+
+// 停用账号不多，进程内保存全部停用的用户 ID，verify() 不必每个请求都访问 Redis。
+// 变化通过频道广播，另外定期从 Redis 全量加载兜底
+var localDisabled = struct {
+	sync.RWMutex
+	ids     map[string]bool
+	loaded  bool
+	changes int64
+}{}
+
+// UserDisabled 账号是否被停用或删除。
+// 停用和删除时在 Redis 中留下标记，verify() 不必每次查询数据库，也能拦住尚未过期的 JWT。
+// 进程内缓存加载完成前直接查询 Redis
+func UserDisabled(ctx context.Context, userID string) (bool, error) {
+	localDisabled.RLock()
+	disabled, loaded := localDisabled.ids[userID], localDisabled.loaded
+	localDisabled.RUnlock()
+	if loaded {
+		return disabled, nil
+	}
+
+	count, err := managers.Redis.Exists(ctx, managers.USERDISABLED+userID).Result()
+	return count > 0, err
+}
+
+func setUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	var err error
+	if disabled {
+		err = managers.Redis.Set(ctx, managers.USERDISABLED+userID, 1, 0).Err()
+	} else {
+		err = managers.Redis.Del(ctx, managers.USERDISABLED+userID).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	markLocalDisabled(userID, disabled)
+
+	state := "0"
+	if disabled {
+		state = "1"
+	}
+	return managers.Redis.Publish(ctx, UserDisabledChannel, userID+":"+state).Err()
+}
+
+func markLocalDisabled(userID string, disabled bool) {
+	localDisabled.Lock()
+	if localDisabled.ids == nil {
+		localDisabled.ids = map[string]bool{}
+	}
+	if disabled {
+		localDisabled.ids[userID] = true
+	} else {
+		delete(localDisabled.ids, userID)
+	}
+	localDisabled.changes++
+	localDisabled.Unlock()
+}
+
+// reloadDisabledUsers 从 Redis 全量加载停用标记。加载期间收到变化时放弃本次结果，等下一轮
+func reloadDisabledUsers(ctx context.Context) error {
+	localDisabled.RLock()
+	changes := localDisabled.changes
+	localDisabled.RUnlock()
+
+	ids := map[string]bool{}
+	iter := managers.Redis.Scan(ctx, 0, managers.USERDISABLED+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		ids[strings.TrimPrefix(iter.Val(), managers.USERDISABLED)] = true
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	localDisabled.Lock()
+	if localDisabled.changes == changes {
+		localDisabled.ids, localDisabled.loaded = ids, true
+	}
+	localDisabled.Unlock()
+	return nil
+}
+
+// StartDisabledUserSync 订阅账号停用状态的变化，并定期全量加载
+func StartDisabledUserSync() {
+	ctx := context.Background()
+	pubsub := managers.Redis.Subscribe(ctx, UserDisabledChannel)
+
+	go func() {
+		for message := range pubsub.Channel() {
+			userID, state, ok := strings.Cut(message.Payload, ":")
+			if !ok {
+				continue
+			}
+			markLocalDisabled(userID, state == "1")
+		}
+		slog.Warn("Disabled user subscription closed")
+	}()
+
+	go func() {
+		ticker := time.NewTicker(disabledReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := reloadDisabledUsers(ctx); err != nil {
+				slog.Error("Failed to load disabled users", "err", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"net/url"
+	"server-go/managers"
+	"server-go/utils"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	EmailVerifyLife  = 24 * time.Hour
+	EmailConfirmPath = "/account/email/confirm"
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrEmailTaken   = errors.New("email address is already in use")
+	ErrLinkInvalid  = errors.New("link is invalid or has expired")
+)
+
+// NormalizeEmail 校验并规范化邮箱地址
+func NormalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// SendEmailVerification 向新地址发送确认链接。同一用户只有最近一次发出的链接有效
+func SendEmailVerification(ctx context.Context, user *User, email string) error {
+	id := managers.IDToString(user.ID)
+	nonce := utils.RandomURLBase64(12)
+
+	if err := managers.Redis.Set(ctx, managers.EMAILVERIFY+id, nonce, EmailVerifyLife).Err(); err != nil {
+		return err
+	}
+
+	token := utils.SignToken(EmailVerifyLife, "email", id, email, nonce)
+	link := managers.Config.ServerURL + EmailConfirmPath + "?token=" + url.QueryEscape(token)
+
+	body := "Hi " + user.Username + ",\r\n\r\n" +
+		"Please confirm your email address by opening the link below within 24 hours:\r\n\r\n" +
+		link + "\r\n\r\n" +
+		"If you did not request this, you can ignore this message."
+
+	return managers.Mail.Send(ctx, email, "Confirm your email address", body)
+}
+
+// ConfirmEmail 校验确认链接，将新地址写入用户并标记为已验证
+func ConfirmEmail(ctx context.Context, token string) (*User, error) {
+	fields, err := utils.VerifyToken(token)
+	if err != nil || len(fields) != 4 || fields[0] != "email" {
+		return nil, ErrLinkInvalid
+	}
+
+	id, email, nonce := fields[1], fields[2], fields[3]
+
+	current, err := managers.Redis.Get(ctx, managers.EMAILVERIFY+id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrLinkInvalid
+		}
+		return nil, err
+	}
+
+	if current != nonce {
+		return nil, ErrLinkInvalid
+	}
+
+	var taken int64
+	if err := managers.DB.Model(&User{}).
+		Where("email = ? AND email_verified = ? AND id <> ?", email, true, id).
+		Count(&taken).Error; err != nil {
+		return nil, err
+	}
+
+	if taken > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	var user User
+	if err := managers.DB.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+
+	if err := managers.DB.Model(&user).Updates(map[string]interface{}{
+		"email":          email,
+		"email_verified": true,
+		"email_pending":  false,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	managers.Redis.Del(ctx, managers.EMAILVERIFY+id)
+
+	return &user, nil
+}
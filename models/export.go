@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"server-go/managers"
+	"time"
+)
+
+// 导出时附带的登录记录条数
+const exportLoginEvents = 1000
+
+// ExportUserData 汇总用户的个人数据，不包含密码哈希、密钥等凭据
+func ExportUserData(ctx context.Context, userID string, currentToken string) (map[string]interface{}, error) {
+	var user User
+	if err := managers.DB.Preload("Role").Preload("Permission").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	sessions, err := ListSessions(ctx, userID, currentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []WebAuthnCredential
+	if err := managers.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+
+	var identities []ExternalIdentity
+	if err := managers.DB.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	var consents []OAuthConsent
+	if err := managers.DB.Where("user_id = ?", user.ID).Find(&consents).Error; err != nil {
+		return nil, err
+	}
+
+	tokens, err := ListPersonalTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := recentLoginEvents(user.ID, exportLoginEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	organizations, err := UserOrganizations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"exportedAt": time.Now(),
+		"profile": map[string]interface{}{
+			"id":                  user.ID,
+			"createdAt":           user.CreatedAt,
+			"username":            user.Username,
+			"name":                user.Name,
+			"email":               user.Email,
+			"emailVerified":       user.EmailVerified,
+			"phoneNumber":         user.PhoneNumber,
+			"phoneVerified":       user.PhoneVerified,
+			"department":          user.Department,
+			"sex":                 user.Sex,
+			"avatar":              user.AvatarPath,
+			"totpEnabled":         user.TOTPEnabled,
+			"passwordChangedAt":   user.PasswordChangedAt,
+			"deletionRequestedAt": user.DeletionRequestedAt,
+		},
+		"roles":               user.Role,
+		"permissions":         user.Permission,
+		"sessions":            sessions,
+		"webauthnCredentials": credentials,
+		"externalIdentities":  identities,
+		"oauthConsents":       consents,
+		"personalTokens":      tokens,
+		"loginEvents":         events,
+		"organizations":       organizations,
+	}, nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"server-go/managers"
+	"server-go/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OIDCStateLife = 10 * time.Minute
+	// OIDCLoginLife 回调后前端换取登录结果的一次性凭据有效期
+	OIDCLoginLife = time.Minute
+)
+
+var (
+	ErrIdentityLinked = errors.New("this external account is already linked to another user")
+	ErrIdentityEmail  = errors.New("an account with this email already exists, sign in and link the external account")
+)
+
+type ExternalIdentity struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	Provider  string    `gorm:"size:50;uniqueIndex:idx_external_identity;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_external_identity;not null" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email,omitempty"`
+}
+
+// OIDCState 跳转到身份提供方前暂存的状态，回调时凭 state 取回
+type OIDCState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	LinkUser string `json:"linkUser,omitempty"`
+}
+
+func FederationInit() {
+	managers.DB.AutoMigrate(&ExternalIdentity{})
+}
+
+// NewOIDCState 生成 state、nonce 和 PKCE，返回 state 及 code_challenge
+func NewOIDCState(ctx context.Context, provider string, linkUser string) (string, *OIDCState, string, error) {
+	data := OIDCState{
+		Provider: provider,
+		Nonce:    utils.RandomURLBase64(18),
+		Verifier: strings.TrimRight(utils.RandomURLBase64(48), "="),
+		LinkUser: linkUser,
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	state := utils.RandomURLBase64(24)
+	if err := managers.Redis.Set(ctx, managers.OIDCSTATE+state, raw, OIDCStateLife).Err(); err != nil {
+		return "", nil, "", err
+	}
+
+	sum := sha256.Sum256([]byte(data.Verifier))
+	return state, &data, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// TakeOIDCState 取出并作废 state
+func TakeOIDCState(ctx context.Context, state string) (*OIDCState, error) {
+	raw, err := managers.Redis.GetDel(ctx, managers.OIDCSTATE+state).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var data OIDCState
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// NewOIDCLogin 回调完成身份校验后签发一次性凭据，前端用它换取登录结果，避免在跳转地址中传递会话或待定登录令牌
+func NewOIDCLogin(ctx context.Context, userID string, provider string) (string, error) {
+	code := utils.RandomURLBase64(24)
+	if err := managers.Redis.Set(ctx, managers.OIDCLOGIN+code, userID+" "+provider, OIDCLoginLife).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// TakeOIDCLogin 取出并作废一次性凭据，返回用户 ID 和身份提供方
+func TakeOIDCLogin(ctx context.Context, code string) (string, string, error) {
+	value, err := managers.Redis.GetDel(ctx, managers.OIDCLOGIN+code).Result()
+	if err != nil {
+		return "", "", err
+	}
+
+	userID, provider, _ := strings.Cut(value, " ")
+	return userID, provider, nil
+}
+
+// LinkIdentity 把外部身份绑定到用户
+func LinkIdentity(userID uint, provider string, claims map[string]interface{}) (*ExternalIdentity, error) {
+	subject, _ := claims["sub"].(string)
+
+	var existing ExternalIdentity
+	err := managers.DB.Where("provider = ? AND subject = ?", provider, subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return &existing, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	identity := ExternalIdentity{UserID: userID, Provider: provider, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+
+	return &identity, managers.DB.Create(&identity).Error
+}
+
+// FederatedUser 查找外部身份对应的用户，未绑定时创建新用户。
+// 不按邮箱自动绑定已有账号，邮箱已被使用时返回 ErrIdentityEmail，需要登录后主动绑定
+func FederatedUser(provider string, claims map[string]interface{}) (*User, error) {
+	subject, _ := claims["sub"].(string)
+
+	var identity ExternalIdentity
+	err := managers.DB.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err == nil {
+		var user User
+		return &user, managers.DB.First(&user, identity.UserID).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	if email != "" {
+		email, err = NormalizeEmail(email)
+		if err != nil {
+			email, emailVerified = "", false
+		}
+	}
+
+	if email != "" && emailVerified {
+		var count int64
+		if err := managers.DB.Model(&User{}).Where("email = ? AND email_verified = ?", email, true).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrIdentityEmail
+		}
+	}
+
+	// 新建账号同样受注册方式限制
+	switch managers.Config.Register.Mode {
+	case RegisterInvite:
+		return nil, ErrRegistrationClosed
+	case RegisterDomain:
+		if !emailVerified || !EmailDomainAllowed(email) {
+			return nil, ErrEmailDomain
+		}
+	}
+
+	var user User
+	err = managers.DB.Transaction(func(tx *gorm.DB) error {
+		user = User{
+			Username: federatedUsername(tx, provider, claims),
+			Name:     stringClaim(claims, "name"),
+		}
+		if emailVerified {
+			user.Email = email
+			user.EmailVerified = true
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&ExternalIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  subject,
+			Email:    email,
+		}).Error
+	})
+
+	return &user, err
+}
+
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// federatedUsername 取 preferred_username 作为用户名，冲突时追加随机后缀
+func federatedUsername(tx *gorm.DB, provider string, claims map[string]interface{}) string {
+	base := usernameCleaner.ReplaceAllString(stringClaim(claims, "preferred_username"), "")
+	if base == "" {
+		base = provider
+	}
+	if len(base) > 20 {
+		base = base[:20]
+	}
+
+	username := base
+	for {
+		var count int64
+		tx.Unscoped().Model(&User{}).Where("username = ?", username).Count(&count)
+		if count == 0 {
+			return username
+		}
+		username = base + "_" + strings.ToLower(utils.RandomString(6))
+	}
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"net/http"
+	"server-go/managers"
+	"server-go/utils"
+	"time"
+)
+
+const ImpersonationLife = 15 * time.Minute
+
+// ImpersonationLog 管理员以用户身份登录的审计记录
+type ImpersonationLog struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time  `json:"createdAt"`
+	AdminID   uint       `gorm:"index;not null" json:"adminId"`
+	UserID    uint       `gorm:"index;not null" json:"userId"`
+	Reason    string     `gorm:"size:255" json:"reason"`
+	IP        string     `gorm:"size:64" json:"ip"`
+	UserAgent string     `gorm:"size:255" json:"userAgent"`
+	Session   string     `gorm:"size:16;index" json:"session"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+func ImpersonationInit() {
+	managers.DB.AutoMigrate(&ImpersonationLog{})
+}
+
+// StartImpersonation 签发以目标用户身份访问的短期会话，会话中同时记录管理员 ID 和管理员原来的会话。
+// 会话计入目标用户的会话索引，用户吊销全部会话时一并失效。
+func StartImpersonation(w http.ResponseWriter, r *http.Request, admin *User, target *User, parentToken string, reason string) (string, error) {
+	ctx := r.Context()
+	token := TokenMaker()
+	adminID := managers.IDToString(admin.ID)
+	userID := managers.IDToString(target.ID)
+	ip := utils.ParseIP(r)
+
+	now := time.Now().Unix()
+	session := map[string]interface{}{
+		"id":      userID,
+		"imp":     adminID,
+		"parent":  parentToken,
+		"ip":      ip,
+		"ua":      r.UserAgent(),
+		"created": now,
+		"seen":    now,
+	}
+
+	if err := utils.HSetAndExpireNonatomic(managers.Redis, ctx, managers.TOKEN+token, session, ImpersonationLife); err != nil {
+		return "", err
+	}
+
+	if err := managers.Redis.SAdd(ctx, managers.SESSIONS+userID, token).Err(); err != nil {
+		return "", err
+	}
+
+	if err := managers.DB.Create(&ImpersonationLog{
+		AdminID:   admin.ID,
+		UserID:    target.ID,
+		Reason:    reason,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Session:   SessionID(token),
+	}).Error; err != nil {
+		RevokeToken(ctx, userID, token)
+		return "", err
+	}
+
+	SetCookie(w, r, &http.Cookie{Name: "token", Value: token, Path: "/", HttpOnly: true, MaxAge: int(ImpersonationLife.Seconds())})
+
+	return token, nil
+}
+
+// EndImpersonation 结束模拟会话，返回管理员原来的会话令牌（已失效时为空）
+func EndImpersonation(w http.ResponseWriter, r *http.Request, userID string, token string) (string, error) {
+	ctx := r.Context()
+
+	parent, err := managers.Redis.HGet(ctx, managers.TOKEN+token, "parent").Result()
+	if err != nil {
+		return "", err
+	}
+
+	if err := RevokeToken(ctx, userID, token); err != nil {
+		return "", err
+	}
+
+	managers.DB.Model(&ImpersonationLog{}).
+		Where("session = ? AND ended_at IS NULL", SessionID(token)).
+		Update("ended_at", time.Now())
+
+	if parent == "" {
+		return "", nil
+	}
+
+	ttl, err := managers.Redis.TTL(ctx, managers.TOKEN+parent).Result()
+	if err != nil || ttl <= 0 {
+		return "", err
+	}
+
+	SetCookie(w, r, &http.Cookie{Name: "token", Value: parent, Path: "/", HttpOnly: true, MaxAge: int(ttl.Seconds())})
+
+	return parent, nil
+}
+
+// ListImpersonations 最近的模拟登录记录
+func ListImpersonations(limit int) ([]ImpersonationLog, error) {
+	var logs []ImpersonationLog
+	err := managers.DB.Order("id DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
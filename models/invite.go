@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/url"
+	"server-go/managers"
+	"server-go/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RegisterOpen   = "open"
+	RegisterInvite = "invite"
+	RegisterDomain = "domain"
+
+	InviteRegisterPath = "/register"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration requires an invite code")
+	ErrEmailDomain        = errors.New("email domain is not allowed")
+	ErrInviteInvalid      = errors.New("invite code is invalid, used up or has expired")
+)
+
+// Invite 邀请码，只保存哈希
+type Invite struct {
+	ID        uint           `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Hash      []byte         `gorm:"uniqueIndex;not null" json:"-"`
+	Hint      string         `gorm:"size:16" json:"hint"`
+	Email     string         `gorm:"size:100" json:"email,omitempty"`
+	MaxUses   int            `gorm:"not null" json:"maxUses"`
+	Uses      int            `gorm:"default:0;not null" json:"uses"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	CreatedBy uint           `json:"createdBy"`
+	Role      []Role         `gorm:"many2many:invite_roles;" json:"roles,omitempty"`
+}
+
+func InviteInit() {
+	managers.DB.AutoMigrate(&Invite{})
+}
+
+func inviteHash(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+// EmailDomainAllowed 邮箱域名是否在允许列表中
+func EmailDomainAllowed(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+
+	domain := strings.ToLower(email[at+1:])
+	return slices.ContainsFunc(managers.Config.Register.AllowedDomains, func(allowed string) bool {
+		return strings.ToLower(allowed) == domain
+	})
+}
+
+// CheckAccountEmail 限定域名模式下，账号只能绑定允许域名的邮箱
+func CheckAccountEmail(email string) error {
+	if managers.Config.Register.Mode == RegisterDomain && !EmailDomainAllowed(email) {
+		return ErrEmailDomain
+	}
+	return nil
+}
+
+// NewInvite 创建邀请码，明文只在此时返回一次
+func NewInvite(createdBy uint, maxUses int, life time.Duration, roles []Role, email string) (string, *Invite, error) {
+	code := utils.RandomURLBase64(18)
+
+	invite := Invite{
+		Hash:      inviteHash(code),
+		Hint:      code[len(code)-4:],
+		Email:     email,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(life),
+		CreatedBy: createdBy,
+		Role:      roles,
+	}
+
+	if err := managers.DB.Create(&invite).Error; err != nil {
+		return "", nil, err
+	}
+
+	return code, &invite, nil
+}
+
+// SendInvitation 把邀请链接发送到指定邮箱
+func SendInvitation(ctx context.Context, invite *Invite, code string) error {
+	link := managers.Config.WebURL + InviteRegisterPath + "?invite=" + url.QueryEscape(code)
+
+	body := "Hi,\r\n\r\n" +
+		"You have been invited to create an account. Open the link below before " + invite.ExpiresAt.Format(time.RFC1123) + " to sign up:\r\n\r\n" +
+		link + "\r\n\r\n" +
+		"If you were not expecting this invitation, you can ignore this message."
+
+	return managers.Mail.Send(ctx, invite.Email, "You're invited", body)
+}
+
+// redeemInvite 在事务中占用一次邀请码，并发注册时不会超出次数
+func redeemInvite(tx *gorm.DB, code string, email string) (*Invite, error) {
+	var invite Invite
+	if err := tx.Preload("Role").Where("hash = ?", inviteHash(code)).First(&invite).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+
+	// 指定了邮箱的邀请码只能由该邮箱使用
+	if invite.Email != "" && invite.Email != email {
+		return nil, ErrInviteInvalid
+	}
+
+	result := tx.Model(&Invite{}).
+		Where("id = ? AND uses < max_uses AND expires_at > ?", invite.ID, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInviteInvalid
+	}
+
+	return &invite, nil
+}
+
+// RegisterUser 按注册方式创建用户。持邀请码注册时自动分配邀请码上的角色
+func RegisterUser(user *User, email string, inviteCode string) error {
+	mode := managers.Config.Register.Mode
+
+	if inviteCode == "" {
+		switch mode {
+		case RegisterInvite:
+			return ErrRegistrationClosed
+		case RegisterDomain:
+			if email == "" || !EmailDomainAllowed(email) {
+				return ErrEmailDomain
+			}
+			// 确认邮箱之前不能登录
+			user.EmailPending = true
+		}
+	}
+
+	return managers.DB.Transaction(func(tx *gorm.DB) error {
+		var invite *Invite
+		if inviteCode != "" {
+			var err error
+			if invite, err = redeemInvite(tx, inviteCode, email); err != nil {
+				return err
+			}
+			user.InviteID = &invite.ID
+
+			// 邀请码发到了这个邮箱，视为已验证
+			if invite.Email != "" {
+				var count int64
+				if err := tx.Model(&User{}).Where("email = ? AND email_verified = ?", email, true).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return ErrEmailTaken
+				}
+				user.Email = email
+				user.EmailVerified = true
+			}
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		if invite != nil && len(invite.Role) > 0 {
+			return tx.Model(user).Association("Role").Append(invite.Role)
+		}
+		return nil
+	})
+}
+
+// ListInvites 列出未删除的邀请码
+func ListInvites() ([]Invite, error) {
+	var invites []Invite
+	err := managers.DB.Preload("Role").Order("id DESC").Find(&invites).Error
+	return invites, err
+}
+
+// RevokeInvite 作废邀请码
+func RevokeInvite(id string) (bool, error) {
+	result := managers.DB.Where("id = ?", id).Delete(&Invite{})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"server-go/managers"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUserSuspended = errors.New("account is suspended")
+
+// Suspended 账号是否被停用
+func (user *User) Suspended() bool {
+	return user.SuspendedAt != nil
+}
+
+// SuspendUser 停用账号并吊销所有会话
+func SuspendUser(ctx context.Context, user *User, reason string) error {
+	now := time.Now()
+	if err := managers.DB.Model(user).Updates(map[string]interface{}{
+		"suspended_at":   now,
+		"suspend_reason": reason,
+	}).Error; err != nil {
+		return err
+	}
+	user.SuspendedAt = &now
+	user.SuspendReason = reason
+
+	userID := managers.IDToString(user.ID)
+	if err := setUserDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+
+	return RevokeAllSessions(ctx, userID)
+}
+
+// UnsuspendUser 恢复被停用的账号
+func UnsuspendUser(ctx context.Context, user *User) error {
+	if err := managers.DB.Model(user).Updates(map[string]interface{}{
+		"suspended_at":   nil,
+		"suspend_reason": "",
+	}).Error; err != nil {
+		return err
+	}
+	user.SuspendedAt = nil
+	user.SuspendReason = ""
+
+	return setUserDisabled(ctx, managers.IDToString(user.ID), false)
+}
+
+// ForcePasswordChange 要求用户下次登录时修改密码，并吊销现有会话
+func ForcePasswordChange(ctx context.Context, user *User) error {
+	if err := managers.DB.Model(user).Update("must_change_password", true).Error; err != nil {
+		return err
+	}
+	user.MustChangePassword = true
+
+	return RevokeAllSessions(ctx, managers.IDToString(user.ID))
+}
+
+// SoftDeleteUser 软删除账号并吊销所有凭据，可以恢复
+func SoftDeleteUser(ctx context.Context, user *User) error {
+	if err := managers.DB.Delete(user).Error; err != nil {
+		return err
+	}
+
+	userID := managers.IDToString(user.ID)
+	if err := setUserDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+
+	return RevokeAllTokens(ctx, userID)
+}
+
+// RestoreUser 恢复软删除的账号。已被注销清除的账号不能恢复
+func RestoreUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	if err := managers.DB.Unscoped().Where("deleted_at IS NOT NULL AND purged_at IS NULL").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := managers.DB.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+
+	return &user, setUserDisabled(ctx, userID, user.Suspended())
+}
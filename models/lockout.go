@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"server-go/managers"
+	"server-go/utils"
+	"time"
+)
+
+// 失败计数按用户名原样记录（用户名区分大小写），不论账号是否存在，避免通过响应差异判断账号是否注册
+
+// LoginThrottle 返回该用户名还需要等待的时间，0 表示可以尝试登录
+func LoginThrottle(ctx context.Context, username string) (time.Duration, error) {
+	var wait time.Duration
+	for _, prefix := range []string{managers.LOGINLOCK, managers.LOGINWAIT} {
+		ttl, err := managers.Redis.PTTL(ctx, prefix+username).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordLoginFailure 记录一次失败：超过免费次数后按指数退避，达到阈值后锁定一段时间
+func RecordLoginFailure(ctx context.Context, username string) error {
+	config := managers.Config.Login
+	failures, err := utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.LOGINFAIL+username, time.Duration(config.FailureWindow)*time.Second)
+	if err != nil {
+		return err
+	}
+
+	if failures >= config.LockoutThreshold {
+		return managers.Redis.Set(ctx, managers.LOGINLOCK+username, failures, time.Duration(config.LockoutDuration)*time.Second).Err()
+	}
+
+	if failures <= config.FreeAttempts {
+		return nil
+	}
+
+	backoff := time.Duration(config.BackoffMax) * time.Second
+	if exponent := failures - config.FreeAttempts - 1; exponent < 20 {
+		backoff = min(time.Duration(config.BackoffBase)*time.Second<<exponent, backoff)
+	}
+
+	return managers.Redis.Set(ctx, managers.LOGINWAIT+username, failures, backoff).Err()
+}
+
+// ResetLoginFailures 登录成功或管理员解锁时清除失败记录
+func ResetLoginFailures(ctx context.Context, username string) error {
+	return managers.Redis.Del(ctx, managers.LOGINFAIL+username, managers.LOGINWAIT+username, managers.LOGINLOCK+username).Err()
+}
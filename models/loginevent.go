@@ -0,0 +1,152 @@
+package models
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/utils"
+	"time"
+)
+
+// 安全事件类型
+const (
+	EventLogin          = "login"
+	EventTwoFactor      = "2fa_challenge"
+	EventPasswordChange = "password_change"
+	EventSessionRevoke  = "session_revoke"
+	EventLogout         = "logout"
+)
+
+// 事件结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeBlocked = "blocked"
+	OutcomeIssued  = "issued"
+)
+
+// 登录方式
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodTOTP         = "totp"
+	LoginMethodRecoveryCode = "recovery_code"
+	LoginMethodWebAuthn     = "webauthn"
+	LoginMethodOIDC         = "oidc"
+	LoginMethodMagicLink    = "magic_link"
+	LoginMethodSMS          = "sms"
+)
+
+const (
+	LoginEventPageSize    = 20
+	LoginEventMaxPageSize = 100
+)
+
+// LoginEvent 登录和账号安全相关的事件。
+// 用户不存在的登录失败同样记录，此时 UserID 为 0，只保留提交的用户名
+type LoginEvent struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	UserID    uint      `gorm:"index" json:"userId"`
+	Username  string    `gorm:"size:64;index" json:"username"`
+	Type      string    `gorm:"size:32;index" json:"type"`
+	Outcome   string    `gorm:"size:16;index" json:"outcome"`
+	Method    string    `gorm:"size:32" json:"method,omitempty"`
+	Detail    string    `gorm:"size:255" json:"detail,omitempty"`
+	IP        string    `gorm:"size:64;index" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"userAgent"`
+}
+
+// LoginEventFilter 查询条件，零值表示不过滤
+type LoginEventFilter struct {
+	UserID   string
+	Username string
+	Type     string
+	Outcome  string
+	IP       string
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
+
+func LoginEventInit() {
+	managers.DB.AutoMigrate(&LoginEvent{})
+}
+
+// RecordLoginEvent 记录安全事件，补全 IP 和 UA。
+// 记录失败只写日志，不影响请求本身
+func RecordLoginEvent(r *http.Request, event *LoginEvent) {
+	event.IP = utils.ParseIP(r)
+	event.UserAgent = r.UserAgent()
+	if len(event.UserAgent) > 255 {
+		event.UserAgent = event.UserAgent[:255]
+	}
+
+	if err := managers.DB.Create(event).Error; err != nil {
+		slog.Error("Failed to record login event", "type", event.Type, "user", event.UserID, "err", err)
+	}
+}
+
+// UserEvent 为已知用户构造事件
+func UserEvent(userID string, eventType string, outcome string) *LoginEvent {
+	id, _ := managers.StringToID(userID)
+	return &LoginEvent{UserID: id, Type: eventType, Outcome: outcome}
+}
+
+// ListLoginEvents 按条件分页查询事件，按时间倒序
+func ListLoginEvents(filter LoginEventFilter) ([]LoginEvent, int64, error) {
+	query := managers.DB.Model(&LoginEvent{})
+
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.PageSize <= 0 {
+		filter.PageSize = LoginEventPageSize
+	}
+	if filter.PageSize > LoginEventMaxPageSize {
+		filter.PageSize = LoginEventMaxPageSize
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	var events []LoginEvent
+	err := query.
+		Order("id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&events).Error
+
+	return events, total, err
+}
+
+// recentLoginEvents 导出个人数据时附带的登录记录
+func recentLoginEvents(userID uint, limit int) ([]LoginEvent, error) {
+	var events []LoginEvent
+	err := managers.DB.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
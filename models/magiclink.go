@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"server-go/managers"
+	"server-go/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	MagicLinkPath   = "/account/login/link/confirm"
+	MagicLinkCookie = "magic_nonce"
+	// MagicLoginLife 打开链接后前端换取登录结果的一次性凭据有效期
+	MagicLoginLife = time.Minute
+)
+
+var ErrMagicLinkBrowser = errors.New("link must be opened in the browser that requested it")
+
+func MagicLinkLife() time.Duration {
+	return time.Duration(managers.Config.MagicLink.Life) * time.Second
+}
+
+func magicNonceHash(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewMagicLinkNonce 生成绑定浏览器的随机数，写入发起请求的浏览器的 Cookie
+func NewMagicLinkNonce() string {
+	return utils.RandomURLBase64(24)
+}
+
+// SendMagicLink 签发一次性登录链接并发送到已验证的邮箱。
+// Redis 中保存用户 ID 和浏览器随机数的哈希，打开链接时两者都要对上
+func SendMagicLink(ctx context.Context, user *User, nonce string) error {
+	id := managers.IDToString(user.ID)
+	linkID := utils.RandomURLBase64(16)
+	life := MagicLinkLife()
+
+	if err := managers.Redis.Set(ctx, managers.MAGICLINK+linkID, id+":"+magicNonceHash(nonce), life).Err(); err != nil {
+		return err
+	}
+
+	token := utils.SignToken(life, "magic", id, linkID)
+	link := managers.Config.ServerURL + MagicLinkPath + "?token=" + url.QueryEscape(token)
+
+	body := "Hi " + user.Username + ",\r\n\r\n" +
+		"Open the link below within " + strconv.Itoa(int(life.Minutes())) + " minutes to sign in. " +
+		"It only works once, and only in the browser where you asked for it:\r\n\r\n" +
+		link + "\r\n\r\n" +
+		"If you did not request this, you can ignore this message."
+
+	return managers.Mail.Send(ctx, user.Email, "Your sign-in link", body)
+}
+
+// TakeMagicLink 校验签名和浏览器随机数，通过后作废链接，返回用户 ID。
+// 随机数不符时不作废，避免邮件客户端预取链接导致用户本人无法使用
+func TakeMagicLink(ctx context.Context, token string, nonce string) (string, error) {
+	fields, err := utils.VerifyToken(token)
+	if err != nil || len(fields) != 3 || fields[0] != "magic" {
+		return "", ErrLinkInvalid
+	}
+
+	userID, linkID := fields[1], fields[2]
+	key := managers.MAGICLINK + linkID
+
+	stored, err := managers.Redis.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrLinkInvalid
+		}
+		return "", err
+	}
+
+	owner, hash, _ := strings.Cut(stored, ":")
+	if owner != userID {
+		return "", ErrLinkInvalid
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(magicNonceHash(nonce))) != 1 {
+		return userID, ErrMagicLinkBrowser
+	}
+
+	// 并发打开时只有一个请求能删除成功
+	deleted, err := managers.Redis.Del(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	if deleted == 0 {
+		return "", ErrLinkInvalid
+	}
+
+	return userID, nil
+}
+
+// NewMagicLogin 链接校验通过后签发一次性凭据，前端用它换取登录结果，避免在跳转地址中传递待定登录令牌或重置令牌
+func NewMagicLogin(ctx context.Context, userID string) (string, error) {
+	code := utils.RandomURLBase64(24)
+	if err := managers.Redis.Set(ctx, managers.MAGICLOGIN+code, userID, MagicLoginLife).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// TakeMagicLogin 取出并作废一次性凭据，返回用户 ID
+func TakeMagicLogin(ctx context.Context, code string) (string, error) {
+	return managers.Redis.GetDel(ctx, managers.MAGICLOGIN+code).Result()
+}
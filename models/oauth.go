@@ -0,0 +1,303 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"server-go/managers"
+	"server-go/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OAuthCodeLife    = time.Minute
+	OAuthRequestLife = 10 * time.Minute
+)
+
+// OAuthScopes 支持的 scope
+var OAuthScopes = []string{"openid", "profile", "email", "phone", "roles"}
+
+var ErrOAuthCodeInvalid = errors.New("authorization code is invalid or has expired")
+
+type OAuthClient struct {
+	ID           uint           `gorm:"primary_key" json:"id"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"-"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ClientID     string         `gorm:"size:64;unique;not null" json:"clientId"`
+	SecretHash   []byte         `json:"-"`
+	Name         string         `gorm:"size:100;not null" json:"name"`
+	RedirectURIs string         `gorm:"type:text" json:"redirectUris"`
+	Scopes       string         `gorm:"size:255" json:"scopes"`
+	Public       bool           `gorm:"default:false;not null" json:"public"`
+}
+
+type OAuthConsent struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	UserID    uint      `gorm:"uniqueIndex:idx_oauth_consent;not null" json:"-"`
+	ClientID  string    `gorm:"size:64;uniqueIndex:idx_oauth_consent;not null" json:"clientId"`
+	Scopes    string    `gorm:"size:255" json:"scopes"`
+}
+
+// OAuthRequest 一次授权请求，等待用户同意时暂存在 Redis，签发授权码后随码保存
+type OAuthRequest struct {
+	ClientID      string `json:"clientId"`
+	UserID        string `json:"userId"`
+	RedirectURI   string `json:"redirectUri"`
+	Scope         string `json:"scope"`
+	State         string `json:"state,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"codeChallenge"`
+	AuthTime      int64  `json:"authTime"`
+}
+
+func OAuthInit() {
+	managers.DB.AutoMigrate(&OAuthClient{}, &OAuthConsent{})
+}
+
+// NewOAuthSecret 生成客户端密钥，数据库只保存哈希
+func (client *OAuthClient) NewOAuthSecret() string {
+	secret := utils.RandomURLBase64(32)
+	client.SecretHash = oauthSecretHash(secret)
+	return secret
+}
+
+// CheckSecret 常量时间比较客户端密钥
+func (client *OAuthClient) CheckSecret(secret string) bool {
+	return len(client.SecretHash) > 0 && subtle.ConstantTimeCompare(client.SecretHash, oauthSecretHash(secret)) == 1
+}
+
+// AllowsRedirect 回调地址必须与注册的地址完全一致
+func (client *OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(strings.Fields(client.RedirectURIs), uri)
+}
+
+// AllowsScope 请求的 scope 必须是客户端允许范围的子集
+func (client *OAuthClient) AllowsScope(scope string) bool {
+	allowed := strings.Fields(client.Scopes)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(allowed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func oauthSecretHash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// CheckPKCE 校验 S256 code_verifier
+func CheckPKCE(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// HasConsent 用户是否已同意该客户端访问这些 scope
+func HasConsent(userID string, clientID string, scope string) (bool, error) {
+	var consent OAuthConsent
+	if err := managers.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	granted := strings.Fields(consent.Scopes)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(granted, s) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SaveConsent 记录用户同意的 scope
+func SaveConsent(userID string, clientID string, scope string) error {
+	id, err := managers.StringToID(userID)
+	if err != nil {
+		return err
+	}
+
+	var consent OAuthConsent
+	if err := managers.DB.Where(OAuthConsent{UserID: id, ClientID: clientID}).FirstOrInit(&consent).Error; err != nil {
+		return err
+	}
+
+	scopes := strings.Fields(consent.Scopes)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	consent.Scopes = strings.Join(scopes, " ")
+
+	return managers.DB.Save(&consent).Error
+}
+
+// SaveOAuthRequest 暂存等待用户同意的授权请求
+func SaveOAuthRequest(ctx context.Context, request *OAuthRequest) (string, error) {
+	return saveOAuthRequest(ctx, managers.OAUTHREQUEST, request, OAuthRequestLife)
+}
+
+// TakeOAuthRequest 取出并作废暂存的授权请求
+func TakeOAuthRequest(ctx context.Context, id string) (*OAuthRequest, error) {
+	return takeOAuthRequest(ctx, managers.OAUTHREQUEST, id)
+}
+
+// NewOAuthCode 为授权请求签发一次性授权码
+func NewOAuthCode(ctx context.Context, request *OAuthRequest) (string, error) {
+	return saveOAuthRequest(ctx, managers.OAUTHCODE, request, OAuthCodeLife)
+}
+
+// TakeOAuthCode 兑换授权码，授权码只能使用一次
+func TakeOAuthCode(ctx context.Context, code string) (*OAuthRequest, error) {
+	return takeOAuthRequest(ctx, managers.OAUTHCODE, code)
+}
+
+func saveOAuthRequest(ctx context.Context, prefix string, request *OAuthRequest, life time.Duration) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	id := utils.RandomURLBase64(24)
+	if err := managers.Redis.Set(ctx, prefix+id, data, life).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func takeOAuthRequest(ctx context.Context, prefix string, id string) (*OAuthRequest, error) {
+	data, err := managers.Redis.GetDel(ctx, prefix+id).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var request OAuthRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, ErrOAuthCodeInvalid
+	}
+
+	return &request, nil
+}
+
+// OAuthClaims 按 scope 组装用户声明，用于 ID Token 和 userinfo
+func OAuthClaims(user *User, scope string) map[string]interface{} {
+	scopes := strings.Fields(scope)
+	claims := map[string]interface{}{"sub": managers.IDToString(user.ID)}
+
+	if slices.Contains(scopes, "profile") {
+		claims["preferred_username"] = user.Username
+		if user.Name != "" {
+			claims["name"] = user.Name
+		}
+	}
+
+	if slices.Contains(scopes, "email") && user.Email != "" {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+
+	if slices.Contains(scopes, "phone") && user.PhoneNumber != "" {
+		claims["phone_number"] = user.PhoneNumber
+		claims["phone_number_verified"] = user.PhoneVerified
+	}
+
+	if slices.Contains(scopes, "roles") {
+		roles := make([]string, 0, len(user.Role)+len(user.InheritedRoles))
+		permissions := map[string]bool{}
+		for _, perm := range user.Permission {
+			permissions[perm.Name] = true
+		}
+		for _, role := range user.EffectiveRoles() {
+			roles = append(roles, role.Name)
+			for _, perm := range role.Permission {
+				permissions[perm.Name] = true
+			}
+		}
+
+		names := make([]string, 0, len(permissions))
+		for name := range permissions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		claims["roles"] = roles
+		claims["permissions"] = names
+	}
+
+	return claims
+}
+
+// NewOAuthAccessToken 为第三方客户端签发访问令牌，带 client_id 以区别于本站令牌
+func NewOAuthAccessToken(subject string, clientID string, scope string, grantType string) (string, error) {
+	now := time.Now()
+
+	return utils.JWTSign(managers.JWTKey, managers.JWTKeyID, utils.JWTTypeAccess, map[string]interface{}{
+		"iss":       managers.Config.ServerURL,
+		"sub":       subject,
+		"aud":       clientID,
+		"client_id": clientID,
+		"scope":     scope,
+		"gty":       grantType,
+		"iat":       now.Unix(),
+		"exp":       now.Add(managers.AccessTokenLife()).Unix(),
+		"jti":       utils.RandomURLBase64(12),
+	})
+}
+
+// VerifyOAuthAccessToken 校验第三方客户端的访问令牌
+func VerifyOAuthAccessToken(token string) (map[string]interface{}, error) {
+	header, claims, err := utils.JWTVerify(token, managers.JWTPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Typ != utils.JWTTypeAccess {
+		return nil, utils.ErrJWTMalformed
+	}
+
+	if iss, _ := claims["iss"].(string); iss != managers.Config.ServerURL {
+		return nil, utils.ErrJWTSignature
+	}
+
+	if clientID, _ := claims["client_id"].(string); clientID == "" {
+		return nil, utils.ErrJWTMalformed
+	}
+
+	return claims, nil
+}
+
+// NewIDToken 签发 OpenID Connect ID Token
+func NewIDToken(user *User, request *OAuthRequest) (string, error) {
+	now := time.Now()
+
+	claims := OAuthClaims(user, request.Scope)
+	claims["iss"] = managers.Config.ServerURL
+	claims["aud"] = request.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(managers.AccessTokenLife()).Unix()
+	claims["auth_time"] = request.AuthTime
+	if request.Nonce != "" {
+		claims["nonce"] = request.Nonce
+	}
+
+	return utils.JWTSign(managers.JWTKey, managers.JWTKeyID, "JWT", claims)
+}
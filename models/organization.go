@@ -0,0 +1,386 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"server-go/managers"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// OrganizationPermissionPrefix 组织角色只能包含 org 命名空间下的权限
+	OrganizationPermissionPrefix = "org" + PermissionSeparator
+	// OrganizationAdminRole 创建组织时生成的管理员角色
+	OrganizationAdminRole = "admin"
+	// OrganizationMemberRole 创建组织时生成的普通成员角色
+	OrganizationMemberRole = "member"
+)
+
+var (
+	ErrOrganizationSlug       = errors.New("slug may only contain lowercase letters, digits and -")
+	ErrOrganizationMember     = errors.New("user is already a member of the organization")
+	ErrOrganizationPermission = errors.New("organization roles may only contain org permissions")
+)
+
+// OrganizationInvitationLife 组织邀请的有效期
+const OrganizationInvitationLife = 7 * 24 * time.Hour
+
+// Organization 组织，成员、角色都按组织隔离
+type Organization struct {
+	ID          uint           `gorm:"primary_key" json:"id"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"-"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	Name        string         `gorm:"size:50;not null" json:"name"`
+	Slug        string         `gorm:"size:50;unique;not null" json:"slug"`
+	Description string         `gorm:"size:255" json:"description"`
+}
+
+// OrganizationMember 组织成员，角色分配只在该组织内生效
+type OrganizationMember struct {
+	ID             uint               `gorm:"primary_key" json:"id"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	OrganizationID uint               `gorm:"uniqueIndex:idx_organization_member;not null" json:"organizationId"`
+	UserID         uint               `gorm:"uniqueIndex:idx_organization_member;index;not null" json:"userId"`
+	User           *User              `json:"user,omitempty"`
+	Organization   *Organization      `json:"organization,omitempty"`
+	Role           []OrganizationRole `gorm:"many2many:organization_member_roles;" json:"roles"`
+}
+
+// OrganizationRole 组织自己定义的角色，名称在组织内唯一
+type OrganizationRole struct {
+	ID             uint         `gorm:"primary_key" json:"id"`
+	CreatedAt      time.Time    `json:"-"`
+	UpdatedAt      time.Time    `json:"-"`
+	OrganizationID uint         `gorm:"uniqueIndex:idx_organization_role;not null" json:"organizationId"`
+	Name           string       `gorm:"size:30;uniqueIndex:idx_organization_role;not null" json:"name"`
+	Description    string       `gorm:"size:255" json:"description"`
+	Permission     []Permission `gorm:"many2many:organization_role_permissions;" json:"permissions,omitempty"`
+}
+
+// OrganizationInvitation 组织向用户发出的邀请，用户接受后才成为成员。
+// 组织管理员看不到非成员的个人信息，只能按用户名发出邀请
+type OrganizationInvitation struct {
+	ID             uint               `gorm:"primary_key" json:"id"`
+	CreatedAt      time.Time          `json:"createdAt"`
+	ExpiresAt      time.Time          `json:"expiresAt"`
+	OrganizationID uint               `gorm:"uniqueIndex:idx_organization_invitation;not null" json:"organizationId"`
+	UserID         uint               `gorm:"uniqueIndex:idx_organization_invitation;index;not null" json:"-"`
+	InvitedBy      uint               `json:"-"`
+	User           *User              `json:"user,omitempty"`
+	Organization   *Organization      `json:"organization,omitempty"`
+	Role           []OrganizationRole `gorm:"many2many:organization_invitation_roles;" json:"roles"`
+}
+
+func OrganizationInit() {
+	managers.DB.AutoMigrate(&Organization{}, &OrganizationMember{}, &OrganizationRole{}, &OrganizationInvitation{})
+}
+
+// TenantDB 限定在组织内的数据库会话，带 OrganizationID 的模型自动按组织过滤
+func TenantDB(ctx context.Context, organizationID uint) *gorm.DB {
+	return managers.DB.WithContext(managers.WithTenant(ctx, organizationID))
+}
+
+// ValidateOrganizationSlug 检查组织标识
+func ValidateOrganizationSlug(slug string) error {
+	if slug == "" || len(slug) > 50 {
+		return ErrOrganizationSlug
+	}
+	for _, c := range slug {
+		if !(c == '-' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return ErrOrganizationSlug
+		}
+	}
+	return nil
+}
+
+// OrganizationPermissions 查找 org 命名空间下的权限，其他权限返回 ErrOrganizationPermission
+func OrganizationPermissions(tx *gorm.DB, ids []string) ([]Permission, error) {
+	var permissions []Permission
+	if len(ids) == 0 {
+		return permissions, nil
+	}
+
+	if err := tx.Where("id IN ?", ids).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	for _, perm := range permissions {
+		if !strings.HasPrefix(strings.TrimPrefix(perm.Name, PermissionDenyPrefix), OrganizationPermissionPrefix) {
+			return nil, ErrOrganizationPermission
+		}
+	}
+	return permissions, nil
+}
+
+// CreateOrganization 创建组织和默认的 admin、member 角色，ownerID 不为 0 时作为首个管理员加入
+func CreateOrganization(ctx context.Context, org *Organization, ownerID uint) error {
+	return managers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+
+		tenant := tx.WithContext(managers.WithTenant(ctx, org.ID))
+
+		var adminPermissions, memberPermissions []Permission
+		if err := tenant.Where("name LIKE ?", OrganizationPermissionPrefix+"%").Find(&adminPermissions).Error; err != nil {
+			return err
+		}
+		for _, perm := range adminPermissions {
+			if perm.Name == "org:members:read" {
+				memberPermissions = append(memberPermissions, perm)
+			}
+		}
+
+		admin := OrganizationRole{Name: OrganizationAdminRole, Description: "组织管理员", Permission: adminPermissions}
+		member := OrganizationRole{Name: OrganizationMemberRole, Description: "组织成员", Permission: memberPermissions}
+		if err := tenant.Create(&admin).Error; err != nil {
+			return err
+		}
+		if err := tenant.Create(&member).Error; err != nil {
+			return err
+		}
+
+		if ownerID == 0 {
+			return nil
+		}
+		return tenant.Create(&OrganizationMember{UserID: ownerID, Role: []OrganizationRole{admin}}).Error
+	})
+}
+
+// DeleteOrganization 删除组织及其成员和角色
+func DeleteOrganization(ctx context.Context, organizationID uint) error {
+	return managers.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tenant := tx.WithContext(managers.WithTenant(ctx, organizationID))
+
+		var members []OrganizationMember
+		if err := tenant.Find(&members).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			if err := tenant.Select("Role").Delete(&members[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		var invitations []OrganizationInvitation
+		if err := tenant.Find(&invitations).Error; err != nil {
+			return err
+		}
+		for i := range invitations {
+			if err := tenant.Select("Role").Delete(&invitations[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		var roles []OrganizationRole
+		if err := tenant.Find(&roles).Error; err != nil {
+			return err
+		}
+		for i := range roles {
+			if err := tenant.Select("Permission").Delete(&roles[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Delete(&Organization{}, organizationID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteOrganizationRole 删除组织角色，tx 需限定在组织内，其他组织的角色视为不存在
+func DeleteOrganizationRole(tx *gorm.DB, roleID uint) error {
+	var role OrganizationRole
+	if err := tx.First(&role, roleID).Error; err != nil {
+		return err
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM organization_member_roles WHERE organization_role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM organization_invitation_roles WHERE organization_role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Select("Permission").Delete(&role).Error
+	})
+}
+
+// InviteOrganizationMember 邀请用户加入组织，tx 需限定在组织内。
+// 已是成员时返回 ErrOrganizationMember，重复邀请时更新角色并重新计算有效期
+func InviteOrganizationMember(tx *gorm.DB, userID uint, invitedBy uint, roles []OrganizationRole) (*OrganizationInvitation, error) {
+	var count int64
+	if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrganizationMember
+	}
+
+	var invitation OrganizationInvitation
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).First(&invitation).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		invitation.UserID = userID
+		invitation.InvitedBy = invitedBy
+		invitation.ExpiresAt = time.Now().Add(OrganizationInvitationLife)
+		if err := tx.Omit("Role").Save(&invitation).Error; err != nil {
+			return err
+		}
+		return tx.Model(&invitation).Association("Role").Replace(roles)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Role = roles
+	return &invitation, nil
+}
+
+// UserOrganizationInvitations 用户收到的未过期邀请
+func UserOrganizationInvitations(userID string) ([]OrganizationInvitation, error) {
+	var invitations []OrganizationInvitation
+	err := managers.DB.Preload("Organization").Preload("Role").
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("id").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// AcceptOrganizationInvitation 接受邀请，按邀请中的角色加入组织
+func AcceptOrganizationInvitation(ctx context.Context, userID string, invitationID string) (*OrganizationMember, error) {
+	var invitation OrganizationInvitation
+	if err := managers.DB.Preload("Role").
+		Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		First(&invitation, invitationID).Error; err != nil {
+		return nil, err
+	}
+
+	var member *OrganizationMember
+	err := TenantDB(ctx, invitation.OrganizationID).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if member, err = addOrganizationMember(tx, invitation.UserID, invitation.Role); err != nil {
+			return err
+		}
+		return tx.Select("Role").Delete(&invitation).Error
+	})
+	return member, err
+}
+
+// DeclineOrganizationInvitation 拒绝邀请，返回是否找到该邀请
+func DeclineOrganizationInvitation(userID string, invitationID string) (bool, error) {
+	var invitation OrganizationInvitation
+	if err := managers.DB.Where("user_id = ?", userID).First(&invitation, invitationID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, managers.DB.Select("Role").Delete(&invitation).Error
+}
+
+// addOrganizationMember 把用户加入组织，roles 为组织内的角色
+func addOrganizationMember(tx *gorm.DB, userID uint, roles []OrganizationRole) (*OrganizationMember, error) {
+	var count int64
+	if err := tx.Model(&OrganizationMember{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrOrganizationMember
+	}
+
+	member := OrganizationMember{UserID: userID, Role: roles}
+	if err := tx.Create(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// FindOrganizationMember 查找组织内的成员及其角色和角色权限
+func FindOrganizationMember(tx *gorm.DB, userID string) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := tx.Preload("Role.Permission").Where("user_id = ?", userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// PermissionMatcher 成员在组织内的权限，只来自组织角色
+func (member *OrganizationMember) PermissionMatcher() *PermissionMatcher {
+	var names []string
+	for _, role := range member.Role {
+		for _, perm := range role.Permission {
+			names = append(names, perm.Name)
+		}
+	}
+	return NewPermissionMatcher(names)
+}
+
+// deleteUserMemberships 删除用户在所有组织中的成员身份和收到的邀请
+func deleteUserMemberships(tx *gorm.DB, userID uint) error {
+	var members []OrganizationMember
+	if err := tx.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return err
+	}
+	for i := range members {
+		if err := tx.Select("Role").Delete(&members[i]).Error; err != nil {
+			return err
+		}
+	}
+
+	var invitations []OrganizationInvitation
+	if err := tx.Where("user_id = ?", userID).Find(&invitations).Error; err != nil {
+		return err
+	}
+	for i := range invitations {
+		if err := tx.Select("Role").Delete(&invitations[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserOrganizations 用户加入的全部组织
+func UserOrganizations(userID string) ([]OrganizationMember, error) {
+	var members []OrganizationMember
+	err := managers.DB.Preload("Organization").Preload("Role").
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&members).Error
+	return members, err
+}
+
+// CanAccessOrganization 组织成员，或拥有全局 manage_organizations 权限的管理员可以进入组织
+func CanAccessOrganization(ctx context.Context, userID string, organizationID uint) (bool, error) {
+	var org Organization
+	if err := managers.DB.Select("id").First(&org, organizationID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var count int64
+	if err := TenantDB(ctx, organizationID).Model(&OrganizationMember{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	perms, err := GetEffectivePermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return perms.HasPermission("manage_organizations"), nil
+}
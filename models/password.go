@@ -0,0 +1,59 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"server-go/managers"
+	"server-go/utils"
+	"time"
+)
+
+const (
+	PasswordResetLife = 30 * time.Minute
+	PasswordResetPath = "/password/reset"
+)
+
+func passwordResetKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return managers.PWRESET + hex.EncodeToString(sum[:])
+}
+
+// NewPasswordResetToken 生成一次性重置令牌，Redis 中只保存令牌的哈希
+func NewPasswordResetToken(ctx context.Context, userID string) (string, error) {
+	token := utils.RandomURLBase64(32)
+
+	if err := managers.Redis.Set(ctx, passwordResetKey(token), userID, PasswordResetLife).Err(); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// SendPasswordReset 把重置链接发送到已验证的邮箱
+func SendPasswordReset(ctx context.Context, user *User) error {
+	token, err := NewPasswordResetToken(ctx, managers.IDToString(user.ID))
+	if err != nil {
+		return err
+	}
+
+	link := managers.Config.WebURL + PasswordResetPath + "?token=" + url.QueryEscape(token)
+
+	body := "Hi " + user.Username + ",\r\n\r\n" +
+		"Someone asked to reset the password of your account. Open the link below within 30 minutes to choose a new one:\r\n\r\n" +
+		link + "\r\n\r\n" +
+		"If you did not request this, you can ignore this message."
+
+	return managers.Mail.Send(ctx, user.Email, "Reset your password", body)
+}
+
+// TakePasswordReset 取出并作废重置令牌，返回对应的用户 ID
+func TakePasswordReset(ctx context.Context, token string) (string, error) {
+	return managers.Redis.GetDel(ctx, passwordResetKey(token)).Result()
+}
+
+// PeekPasswordReset 查询重置令牌对应的用户 ID，不作废令牌，用于先校验新密码
+func PeekPasswordReset(ctx context.Context, token string) (string, error) {
+	return managers.Redis.Get(ctx, passwordResetKey(token)).Result()
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"fmt"
+	"server-go/managers"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// PasswordHistory 以往使用过的密码哈希，用于禁止重复使用
+type PasswordHistory struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"index;not null"`
+	Password  []byte `gorm:"not null"`
+	Salt      []byte
+}
+
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError 密码不符合策略，包含全部违规项
+type PasswordPolicyError struct {
+	Violations []PasswordViolation `json:"violations"`
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+func PasswordPolicyInit() {
+	managers.DB.AutoMigrate(&PasswordHistory{})
+}
+
+// ValidatePassword 按配置的策略检查密码。
+// 对已存在的用户还会检查最近使用过的密码，此时 user 需要带上 password 和 salt。
+func ValidatePassword(user *User, password string) error {
+	policy := managers.Config.Password
+	var violations []PasswordViolation
+
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		violations = append(violations, PasswordViolation{"too_short", fmt.Sprintf("Password must be at least %d characters", policy.MinLength)})
+	}
+	if length > policy.MaxLength {
+		violations = append(violations, PasswordViolation{"too_long", fmt.Sprintf("Password must be at most %d characters", policy.MaxLength)})
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		violations = append(violations, PasswordViolation{"missing_upper", "Password must contain an uppercase letter"})
+	}
+	if policy.RequireLower && !lower {
+		violations = append(violations, PasswordViolation{"missing_lower", "Password must contain a lowercase letter"})
+	}
+	if policy.RequireDigit && !digit {
+		violations = append(violations, PasswordViolation{"missing_digit", "Password must contain a digit"})
+	}
+	if policy.RequireSymbol && !symbol {
+		violations = append(violations, PasswordViolation{"missing_symbol", "Password must contain a symbol"})
+	}
+
+	if _, ok := managers.PasswordDenyList[strings.ToLower(password)]; ok {
+		violations = append(violations, PasswordViolation{"too_common", "Password is too common"})
+	}
+
+	if len(user.Username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(user.Username)) {
+		violations = append(violations, PasswordViolation{"contains_username", "Password must not contain the username"})
+	}
+
+	if user.ID != 0 && policy.History > 0 {
+		reused, err := passwordReused(user, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, PasswordViolation{"reused", fmt.Sprintf("Password must differ from the last %d passwords", policy.History)})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// passwordReused 当前密码加上历史中的 History-1 个密码都不允许再次使用
+func passwordReused(user *User, password string) (bool, error) {
+	if len(user.Password) > 0 {
+		if ok, _ := verifyPasswordHash(password, user.Password, user.Salt); ok {
+			return true, nil
+		}
+	}
+
+	var history []PasswordHistory
+	if err := managers.DB.
+		Where("user_id = ?", user.ID).
+		Order("id DESC").
+		Limit(managers.Config.Password.History - 1).
+		Find(&history).Error; err != nil {
+		return false, err
+	}
+
+	for _, h := range history {
+		if ok, _ := verifyPasswordHash(password, h.Password, h.Salt); ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// UpdatePassword 校验并更新已有用户的密码，旧密码写入历史
+func UpdatePassword(user *User, password string) error {
+	if err := ValidatePassword(user, password); err != nil {
+		return err
+	}
+
+	oldPassword, oldSalt := user.Password, user.Salt
+	user.SetPassword(password)
+	user.MustChangePassword = false
+
+	return managers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password":             user.Password,
+			"salt":                 user.Salt,
+			"password_changed_at":  user.PasswordChangedAt,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+
+		keep := managers.Config.Password.History - 1
+		if keep <= 0 || len(oldPassword) == 0 {
+			return nil
+		}
+
+		if err := tx.Create(&PasswordHistory{UserID: user.ID, Password: oldPassword, Salt: oldSalt}).Error; err != nil {
+			return err
+		}
+
+		// 只保留最近的记录
+		var stale []uint
+		if err := tx.Model(&PasswordHistory{}).
+			Where("user_id = ?", user.ID).
+			Order("id DESC").
+			Offset(keep).
+			Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			return tx.Delete(&PasswordHistory{}, stale).Error
+		}
+		return nil
+	})
+}
+
+// PasswordIsExpired 密码是否超过了最长有效期
+func (user *User) PasswordIsExpired() bool {
+	maxAge := managers.Config.Password.MaxAgeDays
+	if maxAge <= 0 || len(user.Password) == 0 || user.PasswordChangedAt == nil {
+		return false
+	}
+	return time.Since(*user.PasswordChangedAt) > time.Duration(maxAge)*24*time.Hour
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"server-go/managers"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PermissionCacheLife Redis 中的缓存时间，变更时会主动失效，这里只是兜底
+	PermissionCacheLife = 10 * time.Minute
+	// 进程内缓存时间，订阅断开期间错过的失效消息最多影响这么久
+	permissionLocalLife = 30 * time.Second
+	// PermissionChannel 广播失效消息的频道，消息内容为逗号分隔的用户 ID
+	PermissionChannel = "permissions:invalidate"
+)
+
+// EffectivePermissions 用户的有效角色和权限，直接权限与角色权限合并后的结果
+type EffectivePermissions struct {
+	Department       string   `json:"department,omitempty"`
+	Roles            []string `json:"roles"`
+	Permissions      []string `json:"permissions"`
+	RequireTwoFactor bool     `json:"requireTwoFactor"`
+	TOTPEnabled      bool     `json:"totpEnabled"`
+
+	matcherOnce sync.Once
+	matcher     *PermissionMatcher
+}
+
+type permissionEntry struct {
+	value   *EffectivePermissions
+	expires time.Time
+}
+
+var localPermissions = struct {
+	sync.RWMutex
+	entries map[string]permissionEntry
+}{entries: map[string]permissionEntry{}}
+
+// HasPermission 检查是否有指定权限，前缀树在第一次检查时编译，随缓存条目复用
+func (p *EffectivePermissions) HasPermission(name string) bool {
+	p.matcherOnce.Do(func() {
+		p.matcher = NewPermissionMatcher(p.Permissions)
+	})
+	return p.matcher.Match(name)
+}
+
+// HasRole 检查是否有指定角色
+func (p *EffectivePermissions) HasRole(name string) bool {
+	return slices.Contains(p.Roles, name)
+}
+
+// compilePermissions 从数据库计算用户的有效权限
+func compilePermissions(userID string) (*EffectivePermissions, error) {
+	var user User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := user.LoadPermissions(); err != nil {
+		return nil, err
+	}
+
+	result := &EffectivePermissions{
+		Department:       user.Department,
+		Roles:            []string{},
+		Permissions:      []string{},
+		RequireTwoFactor: user.RequiresTwoFactor(),
+		TOTPEnabled:      user.TOTPEnabled,
+	}
+
+	for _, role := range user.EffectiveRoles() {
+		result.Roles = append(result.Roles, role.Name)
+	}
+	result.Permissions = append(result.Permissions, user.PermissionNames()...)
+
+	slices.Sort(result.Permissions)
+	result.Permissions = slices.Compact(result.Permissions)
+
+	return result, nil
+}
+
+type cachedPermissions struct {
+	Generation int64                 `json:"generation"`
+	Value      *EffectivePermissions `json:"value"`
+}
+
+func permissionGenerationKey(userID string) string {
+	return managers.PERMCACHE + "g:" + userID
+}
+
+// GetEffectivePermissions 依次读取进程内缓存、Redis 缓存，都未命中时查询数据库并写回。
+// 每次失效都会递增代数，查询期间发生失效时写回的旧结果因代数不符而被忽略
+func GetEffectivePermissions(ctx context.Context, userID string) (*EffectivePermissions, error) {
+	localPermissions.RLock()
+	entry, ok := localPermissions.entries[userID]
+	localPermissions.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	key := managers.PERMCACHE + userID
+
+	values, err := managers.Redis.MGet(ctx, key, permissionGenerationKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var generation int64
+	if raw, ok := values[1].(string); ok {
+		generation, _ = strconv.ParseInt(raw, 10, 64)
+	}
+
+	var result *EffectivePermissions
+	if raw, ok := values[0].(string); ok {
+		var cached cachedPermissions
+		if json.Unmarshal([]byte(raw), &cached) == nil && cached.Generation == generation {
+			result = cached.Value
+		}
+	}
+
+	if result == nil {
+		if result, err = compilePermissions(userID); err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(cachedPermissions{Generation: generation, Value: result})
+		if err != nil {
+			return nil, err
+		}
+		if err := managers.Redis.Set(ctx, key, data, PermissionCacheLife).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	localPermissions.Lock()
+	localPermissions.entries[userID] = permissionEntry{value: result, expires: time.Now().Add(permissionLocalLife)}
+	localPermissions.Unlock()
+
+	return result, nil
+}
+
+// InvalidatePermissions 清除用户的权限缓存，并通知其他实例丢弃进程内缓存
+func InvalidatePermissions(ctx context.Context, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	pipe := managers.Redis.TxPipeline()
+	for _, id := range userIDs {
+		pipe.Incr(ctx, permissionGenerationKey(id))
+		// 代数比缓存活得久，过期重置时旧缓存早已过期
+		pipe.Expire(ctx, permissionGenerationKey(id), 6*PermissionCacheLife)
+		pipe.Del(ctx, managers.PERMCACHE+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	dropLocalPermissions(userIDs)
+
+	return managers.Redis.Publish(ctx, PermissionChannel, strings.Join(userIDs, ",")).Err()
+}
+
+// InvalidateRolePermissions 清除拥有该角色或其子角色的所有用户的权限缓存
+func InvalidateRolePermissions(ctx context.Context, roleIDs ...uint) error {
+	index, err := loadRoleIndex(managers.DB)
+	if err != nil {
+		return err
+	}
+
+	userIDs, err := roleUserIDs(index.descendants(roleIDs))
+	if err != nil {
+		return err
+	}
+
+	return InvalidatePermissions(ctx, userIDs...)
+}
+
+func dropLocalPermissions(userIDs []string) {
+	localPermissions.Lock()
+	for _, id := range userIDs {
+		delete(localPermissions.entries, id)
+	}
+	localPermissions.Unlock()
+}
+
+func pruneLocalPermissions() {
+	now := time.Now()
+	localPermissions.Lock()
+	for id, entry := range localPermissions.entries {
+		if now.After(entry.expires) {
+			delete(localPermissions.entries, id)
+		}
+	}
+	localPermissions.Unlock()
+}
+
+// StartPermissionInvalidation 订阅失效消息，丢弃进程内缓存中对应的用户或策略，并定期清理过期条目
+func StartPermissionInvalidation() {
+	pubsub := managers.Redis.Subscribe(context.Background(), PermissionChannel, PolicyChannel)
+
+	go func() {
+		for message := range pubsub.Channel() {
+			if message.Channel == PolicyChannel {
+				dropLocalPolicies()
+				continue
+			}
+			dropLocalPermissions(strings.Split(message.Payload, ","))
+		}
+		slog.Warn("Permission invalidation subscription closed")
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			pruneLocalPermissions()
+		}
+	}()
+}
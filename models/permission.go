@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"server-go/managers"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPermissionName      = errors.New("permission name may only contain letters, digits, _ and -, separated by :")
+	ErrPermissionNamespace = errors.New("permission namespace is not registered")
+)
+
+// PermissionNamespace 由管理员登记的权限命名空间，例如 users、content。
+// 带 : 的权限名第一段必须是已登记的命名空间
+type PermissionNamespace struct {
+	ID          uint      `gorm:"primary_key" json:"id"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Name        string    `gorm:"size:30;unique;not null" json:"name"`
+	Description string    `gorm:"size:255" json:"description"`
+}
+
+func validPermissionSegment(segment string) bool {
+	if segment == PermissionWildcard {
+		return true
+	}
+	if segment == "" {
+		return false
+	}
+	for _, c := range segment {
+		if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateNamespaceName 命名空间只能是一段，不能是通配符
+func ValidateNamespaceName(name string) error {
+	if name == PermissionWildcard || !validPermissionSegment(name) {
+		return ErrPermissionName
+	}
+	return nil
+}
+
+// validPermissionPattern 每一段都是合法字符或通配符
+func validPermissionPattern(name string) bool {
+	for _, segment := range strings.Split(name, PermissionSeparator) {
+		if !validPermissionSegment(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidatePermissionName 检查权限名格式，带命名空间的还要检查命名空间是否已登记。
+// 没有 : 的旧权限名（如 manage_users）不受命名空间限制
+func ValidatePermissionName(name string) error {
+	name = strings.TrimPrefix(name, PermissionDenyPrefix)
+	if !validPermissionPattern(name) {
+		return ErrPermissionName
+	}
+
+	segments := strings.Split(name, PermissionSeparator)
+	if len(segments) == 1 || segments[0] == PermissionWildcard {
+		return nil
+	}
+
+	var count int64
+	if err := managers.DB.Model(&PermissionNamespace{}).Where("name = ?", segments[0]).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPermissionNamespace
+	}
+	return nil
+}
+
+// NamespacePermissionCount 命名空间下已有的权限数量，包括拒绝条目
+func NamespacePermissionCount(namespace string) (int64, error) {
+	// _ 在 LIKE 中是通配符，需要转义
+	prefix := strings.ReplaceAll(namespace, "_", `\_`) + PermissionSeparator
+	var count int64
+	err := managers.DB.Model(&Permission{}).
+		Where(`name LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\'`, prefix+"%", PermissionDenyPrefix+prefix+"%").
+		Count(&count).Error
+	return count, err
+}
+
+// PermissionNames 用户直接拥有和通过角色（包括继承的角色）拥有的全部授权条目
+func (user *User) PermissionNames() []string {
+	var names []string
+	for _, perm := range user.Permission {
+		names = append(names, perm.Name)
+	}
+	for _, role := range user.EffectiveRoles() {
+		for _, perm := range role.Permission {
+			names = append(names, perm.Name)
+		}
+	}
+	return names
+}
+
+// PermissionMatcher 编译用户已加载的权限
+func (user *User) PermissionMatcher() *PermissionMatcher {
+	return NewPermissionMatcher(user.PermissionNames())
+}
@@ -0,0 +1,82 @@
+package models
+
+import "strings"
+
+// 权限名按 ":" 分段，例如 users:read、content:posts:edit。授权时可以使用通配符：
+// 末尾的 * 匹配剩余的一段或多段（content:* 匹配 content:read 和 content:posts:edit），
+// 中间的 * 匹配任意一段（*:read），单独的 * 匹配所有权限。
+// 以 ! 开头的是显式拒绝，优先于所有允许，例如 !users:delete
+const (
+	PermissionSeparator  = ":"
+	PermissionWildcard   = "*"
+	PermissionDenyPrefix = "!"
+)
+
+type permissionNode struct {
+	children map[string]*permissionNode
+	// terminal 到此为止是一条完整的授权
+	terminal bool
+	// rest 授权以 * 结尾，匹配剩余的一段或多段
+	rest bool
+}
+
+func (node *permissionNode) insert(segments []string) {
+	for i, segment := range segments {
+		if segment == PermissionWildcard && i == len(segments)-1 {
+			node.rest = true
+			return
+		}
+
+		if node.children == nil {
+			node.children = map[string]*permissionNode{}
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			child = &permissionNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.terminal = true
+}
+
+func (node *permissionNode) match(segments []string) bool {
+	if len(segments) == 0 {
+		return node.terminal
+	}
+	if node.rest {
+		return true
+	}
+	if child, ok := node.children[segments[0]]; ok && child.match(segments[1:]) {
+		return true
+	}
+	if child, ok := node.children[PermissionWildcard]; ok && child.match(segments[1:]) {
+		return true
+	}
+	return false
+}
+
+// PermissionMatcher 由授权列表预编译的前缀树，构建后只读，可以并发使用
+type PermissionMatcher struct {
+	allow permissionNode
+	deny  permissionNode
+}
+
+// NewPermissionMatcher 编译授权列表，! 开头的条目为拒绝
+func NewPermissionMatcher(grants []string) *PermissionMatcher {
+	matcher := &PermissionMatcher{}
+	for _, grant := range grants {
+		if name, ok := strings.CutPrefix(grant, PermissionDenyPrefix); ok {
+			matcher.deny.insert(strings.Split(name, PermissionSeparator))
+		} else if grant != "" {
+			matcher.allow.insert(strings.Split(grant, PermissionSeparator))
+		}
+	}
+	return matcher
+}
+
+// Match 检查是否授予了指定权限，命中拒绝条目时总是返回 false
+func (matcher *PermissionMatcher) Match(name string) bool {
+	segments := strings.Split(name, PermissionSeparator)
+	return !matcher.deny.match(segments) && matcher.allow.match(segments)
+}
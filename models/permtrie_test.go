@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestPermissionMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		grants []string
+		check  string
+		want   bool
+	}{
+		{"exact", []string{"users:read"}, "users:read", true},
+		{"exact other action", []string{"users:read"}, "users:write", false},
+		{"prefix is not a grant", []string{"users:read"}, "users", false},
+		{"grant is not a prefix", []string{"users"}, "users:read", false},
+		{"longer name", []string{"users:read"}, "users:read:all", false},
+		{"no grants", nil, "users:read", false},
+		{"empty grant ignored", []string{""}, "", false},
+
+		{"global wildcard", []string{"*"}, "content:posts:edit", true},
+		{"trailing wildcard one segment", []string{"content:*"}, "content:read", true},
+		{"trailing wildcard several segments", []string{"content:*"}, "content:posts:edit", true},
+		{"trailing wildcard needs a segment", []string{"content:*"}, "content", false},
+		{"trailing wildcard other prefix", []string{"content:*"}, "users:read", false},
+
+		{"mid-segment wildcard", []string{"*:read"}, "users:read", true},
+		{"mid-segment wildcard other action", []string{"*:read"}, "users:write", false},
+		{"mid-segment wildcard one segment only", []string{"*:read"}, "content:posts:read", false},
+		{"mid-segment wildcard inside", []string{"content:*:edit"}, "content:posts:edit", true},
+		{"mid-segment wildcard inside too long", []string{"content:*:edit"}, "content:posts:drafts:edit", false},
+		{"mid and trailing wildcard", []string{"content:*:*"}, "content:posts:drafts:edit", true},
+		{"mid and trailing wildcard too short", []string{"content:*:*"}, "content:posts", false},
+		{"falls back from literal to wildcard branch", []string{"content:posts:view", "content:*:edit"}, "content:posts:edit", true},
+
+		{"deny beats exact allow", []string{"users:delete", "!users:delete"}, "users:delete", false},
+		{"deny beats wildcard", []string{"*", "!users:delete"}, "users:delete", false},
+		{"deny leaves siblings", []string{"*", "!users:delete"}, "users:read", true},
+		{"deny order does not matter", []string{"!users:delete", "users:*"}, "users:delete", false},
+		{"wildcard deny", []string{"*", "!billing:*"}, "billing:invoices:read", false},
+		{"wildcard deny leaves others", []string{"*", "!billing:*"}, "users:read", true},
+		{"mid-segment deny", []string{"*", "!*:delete"}, "posts:delete", false},
+		{"mid-segment deny leaves others", []string{"*", "!*:delete"}, "posts:edit", true},
+		{"global deny", []string{"users:read", "!*"}, "users:read", false},
+		{"deny without allow", []string{"!users:delete"}, "users:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPermissionMatcher(tt.grants).Match(tt.check); got != tt.want {
+				t.Errorf("Match(%q) with %q = %v, want %v", tt.check, tt.grants, got, tt.want)
+			}
+		})
+	}
+}
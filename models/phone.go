@@ -0,0 +1,207 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"server-go/managers"
+	"server-go/utils"
+	"strings"
+	"time"
+)
+
+// 短信验证码用途，不同用途的验证码互不通用
+const (
+	PhoneCodeVerify = "verify"
+	PhoneCodeLogin  = "login"
+)
+
+const phoneCodeDigits = 6
+
+var (
+	ErrInvalidPhone    = errors.New("invalid phone number")
+	ErrPhoneTaken      = errors.New("phone number is already in use")
+	ErrSMSCooldown     = errors.New("a code was sent recently, please wait before requesting another")
+	ErrPhoneCode       = errors.New("code is incorrect or has expired")
+	ErrPhoneCodeTries  = errors.New("too many attempts, please request a new code")
+	phoneNumberRemover = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+// NormalizePhone 把号码规范化为 E.164 格式，不带国家码的号码补上默认国家码
+func NormalizePhone(number string) (string, error) {
+	number = phoneNumberRemover.Replace(strings.TrimSpace(number))
+
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	if !strings.HasPrefix(number, "+") {
+		if managers.Config.SMS.CountryCode == "" {
+			return "", ErrInvalidPhone
+		}
+		number = "+" + managers.Config.SMS.CountryCode + strings.TrimPrefix(number, "0")
+	}
+
+	digits := number[1:]
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", ErrInvalidPhone
+		}
+	}
+
+	return number, nil
+}
+
+// PhoneTaken 号码是否已被其他用户验证
+func PhoneTaken(phone string, userID string) (bool, error) {
+	var count int64
+	err := managers.DB.Model(&User{}).
+		Where("phone_number = ? AND phone_verified = ? AND id <> ?", phone, true, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func phoneCodeKey(purpose string, phone string) string {
+	return managers.SMSCODE + purpose + ":" + phone
+}
+
+// phoneCodeHash 验证码只有六位，用带密钥的哈希保存，Redis 泄露时也无法离线穷举
+func phoneCodeHash(phone string, code string) string {
+	mac := hmac.New(sha256.New, []byte(managers.Config.Secret))
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newPhoneCode() (string, error) {
+	var code strings.Builder
+	for range phoneCodeDigits {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(byte('0' + n.Int64()))
+	}
+	return code.String(), nil
+}
+
+// SendPhoneCode 向号码发送验证码，同一号码在冷却时间内只能发送一次。
+// 新验证码会覆盖同一用途下尚未使用的旧验证码
+func SendPhoneCode(ctx context.Context, purpose string, phone string, userID string) error {
+	config := managers.Config.SMS
+
+	fresh, err := managers.Redis.SetNX(ctx, managers.SMSCOOLDOWN+phone, 1, time.Duration(config.Cooldown)*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrSMSCooldown
+	}
+
+	code, err := newPhoneCode()
+	if err != nil {
+		return err
+	}
+
+	life := time.Duration(config.CodeLife) * time.Second
+	key := phoneCodeKey(purpose, phone)
+
+	if err := managers.Redis.Del(ctx, key).Err(); err != nil {
+		return err
+	}
+
+	if err := utils.HSetAndExpireNonatomic(managers.Redis, ctx, key, map[string]interface{}{
+		"code":  phoneCodeHash(phone, code),
+		"id":    userID,
+		"tries": 0,
+	}, life); err != nil {
+		return err
+	}
+
+	message := code + " is your verification code. It expires in " + life.String() + ". Do not share it with anyone."
+
+	if err := managers.SMS.Send(ctx, phone, message); err != nil {
+		managers.Redis.Del(ctx, key, managers.SMSCOOLDOWN+phone)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyPhoneCode 校验验证码并返回发送时绑定的用户 ID，超过尝试次数或验证通过后验证码作废
+func VerifyPhoneCode(ctx context.Context, purpose string, phone string, code string) (string, error) {
+	key := phoneCodeKey(purpose, phone)
+
+	values, err := managers.Redis.HMGet(ctx, key, "code", "id").Result()
+	if err != nil {
+		return "", err
+	}
+
+	hash, _ := values[0].(string)
+	userID, _ := values[1].(string)
+	if hash == "" {
+		return "", ErrPhoneCode
+	}
+
+	tries, err := managers.Redis.HIncrBy(ctx, key, "tries", 1).Result()
+	if err != nil {
+		return "", err
+	}
+
+	if tries > managers.Config.SMS.MaxAttempts {
+		managers.Redis.Del(ctx, key)
+		return "", ErrPhoneCodeTries
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(phoneCodeHash(phone, code))) {
+		return "", ErrPhoneCode
+	}
+
+	// 并发提交时只有一个请求能删除成功
+	deleted, err := managers.Redis.Del(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	if deleted == 0 {
+		return "", ErrPhoneCode
+	}
+
+	return userID, nil
+}
+
+// ConfirmPhone 写入已验证的号码
+func ConfirmPhone(user *User, phone string) error {
+	taken, err := PhoneTaken(phone, managers.IDToString(user.ID))
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrPhoneTaken
+	}
+
+	if err := managers.DB.Model(user).Updates(map[string]interface{}{
+		"phone_number":   phone,
+		"phone_verified": true,
+	}).Error; err != nil {
+		return err
+	}
+
+	user.PhoneNumber = phone
+	user.PhoneVerified = true
+	return nil
+}
+
+// FindUserByPhone 按已验证的号码查找用户
+func FindUserByPhone(phone string) (*User, error) {
+	var user User
+	if err := managers.DB.Where("phone_number = ? AND phone_verified = ?", phone, true).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
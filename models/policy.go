@@ -0,0 +1,255 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"server-go/managers"
+	"server-go/utils"
+	"sync"
+	"time"
+)
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+	// PolicyAny 资源类型为 * 时匹配全部，动作与权限名一样支持通配符
+	PolicyAny = "*"
+
+	// PolicyChannel 广播策略变更的频道
+	PolicyChannel = "policies:invalidate"
+	// 进程内策略缓存时间，订阅断开期间错过的变更最多影响这么久
+	policyLocalLife = 30 * time.Second
+)
+
+var ErrPolicyEffect = errors.New("effect must be allow or deny")
+
+// Policy 基于属性的授权规则。Condition 是 utils.ParseExpr 支持的表达式，
+// 可以引用 subject（当前用户）、resource（被访问的资源）和 action，为空表示总是成立
+type Policy struct {
+	ID           uint      `gorm:"primary_key" json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Name         string    `gorm:"size:50;unique;not null" json:"name"`
+	Description  string    `gorm:"size:255" json:"description"`
+	Action       string    `gorm:"size:50;index;not null" json:"action"`
+	ResourceType string    `gorm:"size:50;not null" json:"resourceType"`
+	Effect       string    `gorm:"size:10;not null" json:"effect"`
+	Condition    string    `gorm:"size:2048" json:"condition"`
+	Enabled      bool      `gorm:"default:true;not null" json:"enabled"`
+}
+
+// Resource 被访问的资源，Attributes 中的值可在条件中以 resource.xxx 引用
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes map[string]any
+}
+
+type compiledPolicy struct {
+	Policy
+	action    *PermissionMatcher
+	condition *utils.Expr
+}
+
+var localPolicies = struct {
+	sync.RWMutex
+	policies []compiledPolicy
+	expires  time.Time
+	// 每次失效递增，加载期间发生失效时不写回旧结果
+	version uint64
+}{}
+
+func PolicyInit() {
+	managers.DB.AutoMigrate(&Policy{})
+}
+
+// Validate 检查效果和条件表达式，保存前调用
+func (policy *Policy) Validate() error {
+	if policy.Effect != PolicyAllow && policy.Effect != PolicyDeny {
+		return ErrPolicyEffect
+	}
+	if policy.Action == "" {
+		policy.Action = PolicyAny
+	}
+	if !validPermissionPattern(policy.Action) {
+		return ErrPermissionName
+	}
+	if policy.ResourceType == "" {
+		policy.ResourceType = PolicyAny
+	}
+	if policy.Condition == "" {
+		return nil
+	}
+	_, err := utils.ParseExpr(policy.Condition)
+	return err
+}
+
+// PolicyResource 用户作为被访问的资源，例如限制只能管理同部门的用户。
+// 需要在条件中引用 resource.roles 时先加载角色和继承的角色
+func (user *User) PolicyResource() *Resource {
+	roles := []string{}
+	for _, role := range user.EffectiveRoles() {
+		roles = append(roles, role.Name)
+	}
+
+	return &Resource{
+		Type: "user",
+		ID:   managers.IDToString(user.ID),
+		Attributes: map[string]any{
+			"username":   user.Username,
+			"department": user.Department,
+			"suspended":  user.Suspended(),
+			"roles":      roles,
+		},
+	}
+}
+
+// loadPolicies 读取启用的策略并编译条件，结果在进程内缓存
+func loadPolicies() ([]compiledPolicy, error) {
+	localPolicies.RLock()
+	policies, expires, version := localPolicies.policies, localPolicies.expires, localPolicies.version
+	localPolicies.RUnlock()
+	if time.Now().Before(expires) {
+		return policies, nil
+	}
+
+	var rows []Policy
+	if err := managers.DB.Where("enabled = ?", true).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	policies = make([]compiledPolicy, 0, len(rows))
+	for _, row := range rows {
+		compiled := compiledPolicy{Policy: row, action: NewPermissionMatcher([]string{row.Action})}
+		if row.Condition != "" {
+			expr, err := utils.ParseExpr(row.Condition)
+			if err != nil {
+				// 保存时已校验，这里只会是直接改库造成的，按条件求值失败处理
+				slog.Error("Invalid policy condition", "policy", row.Name, "err", err)
+			}
+			compiled.condition = expr
+		}
+		policies = append(policies, compiled)
+	}
+
+	localPolicies.Lock()
+	if localPolicies.version == version {
+		localPolicies.policies = policies
+		localPolicies.expires = time.Now().Add(policyLocalLife)
+	}
+	localPolicies.Unlock()
+
+	return policies, nil
+}
+
+func dropLocalPolicies() {
+	localPolicies.Lock()
+	localPolicies.expires = time.Time{}
+	localPolicies.version++
+	localPolicies.Unlock()
+}
+
+// InvalidatePolicies 策略变更后通知所有实例重新加载
+func InvalidatePolicies(ctx context.Context) error {
+	dropLocalPolicies()
+	return managers.Redis.Publish(ctx, PolicyChannel, "").Err()
+}
+
+// matches 判断策略是否适用于该动作和资源，条件求值出错时返回 error
+func (policy *compiledPolicy) matches(action string, resourceType string, env map[string]any) (bool, error) {
+	if !policy.action.Match(action) {
+		return false, nil
+	}
+	if policy.ResourceType != PolicyAny && policy.ResourceType != resourceType {
+		return false, nil
+	}
+	if policy.Condition == "" {
+		return true, nil
+	}
+	if policy.condition == nil {
+		return false, utils.ErrExprSyntax
+	}
+	return policy.condition.Eval(env)
+}
+
+// policyEnv 构造条件表达式可以引用的变量
+func policyEnv(userID string, perms *EffectivePermissions, action string, resource *Resource) map[string]any {
+	subject := map[string]any{
+		"id":          userID,
+		"department":  perms.Department,
+		"roles":       perms.Roles,
+		"permissions": perms.Permissions,
+	}
+	if id, err := managers.StringToID(userID); err == nil {
+		subject["id"] = id
+	}
+
+	object := map[string]any{}
+	if resource != nil {
+		for key, value := range resource.Attributes {
+			object[key] = value
+		}
+		object["type"] = resource.Type
+		if id, err := managers.StringToID(resource.ID); err == nil {
+			object["id"] = id
+		} else if resource.ID != "" {
+			object["id"] = resource.ID
+		}
+	}
+
+	return map[string]any{
+		"subject":  subject,
+		"resource": object,
+		"action":   action,
+	}
+}
+
+// Authorize 判断用户能否对资源执行动作。
+// 匹配的 deny 策略优先；否则拥有同名全局权限或匹配任一 allow 策略即可。
+// deny 策略求值出错时按拒绝处理，allow 策略求值出错时视为不匹配
+func Authorize(ctx context.Context, userID string, action string, resource *Resource) (bool, error) {
+	perms, err := GetEffectivePermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return AuthorizeWith(userID, perms, action, resource)
+}
+
+// AuthorizeWith 与 Authorize 相同，使用调用方已经读取的有效权限
+func AuthorizeWith(userID string, perms *EffectivePermissions, action string, resource *Resource) (bool, error) {
+	policies, err := loadPolicies()
+	if err != nil {
+		return false, err
+	}
+
+	resourceType := ""
+	if resource != nil {
+		resourceType = resource.Type
+	}
+	env := policyEnv(userID, perms, action, resource)
+
+	allowed := perms.HasPermission(action)
+	for i := range policies {
+		policy := &policies[i]
+		if allowed && policy.Effect == PolicyAllow {
+			continue
+		}
+
+		matched, err := policy.matches(action, resourceType, env)
+		if err != nil {
+			slog.Warn("Failed to evaluate policy", "policy", policy.Name, "user", userID, "action", action, "err", err)
+			matched = policy.Effect == PolicyDeny
+		}
+		if !matched {
+			continue
+		}
+
+		if policy.Effect == PolicyDeny {
+			return false, nil
+		}
+		allowed = true
+	}
+
+	return allowed, nil
+}
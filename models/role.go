@@ -0,0 +1,271 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"server-go/managers"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleCycle  = errors.New("parent role would create a cycle")
+	ErrRoleParent = errors.New("parent role does not exist")
+)
+
+// roleIndex 全部角色按 ID 索引，角色数量不多，计算继承关系时一次性加载
+type roleIndex map[uint]*Role
+
+func loadRoleIndex(tx *gorm.DB) (roleIndex, error) {
+	var roles []Role
+	if err := tx.Preload("Permission").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	index := make(roleIndex, len(roles))
+	for i := range roles {
+		index[roles[i].ID] = &roles[i]
+	}
+	return index, nil
+}
+
+// ancestors 沿父角色向上查找，已删除的父角色视为链条终点。
+// 数据库中若已存在环，遇到已访问的角色即停止
+func (index roleIndex) ancestors(id uint) []*Role {
+	var result []*Role
+	visited := map[uint]bool{id: true}
+
+	role, ok := index[id]
+	for ok && role.ParentID != nil && !visited[*role.ParentID] {
+		visited[*role.ParentID] = true
+		if role, ok = index[*role.ParentID]; ok {
+			result = append(result, role)
+		}
+	}
+
+	return result
+}
+
+// inCycle 沿父角色向上能否回到自身
+func (index roleIndex) inCycle(id uint) bool {
+	visited := map[uint]bool{}
+	role, ok := index[id]
+	for ok && role.ParentID != nil && !visited[role.ID] {
+		if *role.ParentID == id {
+			return true
+		}
+		visited[role.ID] = true
+		role, ok = index[*role.ParentID]
+	}
+	return false
+}
+
+// createsCycle 把 parentID 设为 roleID 的父角色后是否会形成环
+func (index roleIndex) createsCycle(roleID uint, parentID uint) bool {
+	if parentID == roleID {
+		return true
+	}
+	for _, ancestor := range index.ancestors(parentID) {
+		if ancestor.ID == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+// descendants 返回直接和间接继承自给定角色的所有角色 ID，包含给定角色本身
+func (index roleIndex) descendants(ids []uint) []uint {
+	result := slices.Clone(ids)
+	for id := range index {
+		if slices.Contains(result, id) {
+			continue
+		}
+		for _, ancestor := range index.ancestors(id) {
+			if slices.Contains(ids, ancestor.ID) {
+				result = append(result, id)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// LoadInheritedRoles 根据已加载的直接角色，计算通过父角色继承到的角色
+func (user *User) LoadInheritedRoles() error {
+	user.InheritedRoles = nil
+	if len(user.Role) == 0 {
+		return nil
+	}
+
+	index, err := loadRoleIndex(managers.DB)
+	if err != nil {
+		return err
+	}
+
+	seen := map[uint]bool{}
+	for _, role := range user.Role {
+		seen[role.ID] = true
+	}
+
+	for _, role := range user.Role {
+		for _, ancestor := range index.ancestors(role.ID) {
+			if !seen[ancestor.ID] {
+				seen[ancestor.ID] = true
+				user.InheritedRoles = append(user.InheritedRoles, *ancestor)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RoleGrants 查找给定的角色，返回这些角色以及它们（含继承）授予的全部角色名和权限名，deny 条目不计入
+func RoleGrants(ids []string) ([]Role, []string, []string, error) {
+	var roles []Role
+	if len(ids) == 0 {
+		return roles, nil, nil, nil
+	}
+
+	if err := managers.DB.Find(&roles, ids).Error; err != nil {
+		return nil, nil, nil, err
+	}
+
+	index, err := loadRoleIndex(managers.DB)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var names, permissions []string
+	for _, role := range roles {
+		granted, ok := index[role.ID]
+		if !ok {
+			continue
+		}
+		for _, grant := range append([]*Role{granted}, index.ancestors(role.ID)...) {
+			names = append(names, grant.Name)
+			for _, perm := range grant.Permission {
+				if !strings.HasPrefix(perm.Name, PermissionDenyPrefix) {
+					permissions = append(permissions, perm.Name)
+				}
+			}
+		}
+	}
+
+	slices.Sort(names)
+	slices.Sort(permissions)
+	return roles, slices.Compact(names), slices.Compact(permissions), nil
+}
+
+// EffectiveRoles 直接角色加上继承的角色
+func (user *User) EffectiveRoles() []Role {
+	return append(slices.Clone(user.Role), user.InheritedRoles...)
+}
+
+// SetRoleParent 设置父角色，parentID 为 nil 时取消继承
+func SetRoleParent(ctx context.Context, roleID uint, parentID *uint) error {
+	err := managers.DB.Transaction(func(tx *gorm.DB) error {
+		if parentID != nil {
+			index, err := loadRoleIndex(tx)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := index[*parentID]; !ok {
+				return ErrRoleParent
+			}
+
+			if index.createsCycle(roleID, *parentID) {
+				return ErrRoleCycle
+			}
+		}
+
+		return tx.Model(&Role{}).Where("id = ?", roleID).Update("parent_id", parentID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return InvalidateRolePermissions(ctx, roleID)
+}
+
+// DeleteRole 删除角色，子角色改为继承被删除角色的父角色
+func DeleteRole(ctx context.Context, roleID uint) error {
+	// 先算出受影响的用户，删除后子角色的继承链会改变
+	index, err := loadRoleIndex(managers.DB)
+	if err != nil {
+		return err
+	}
+
+	role, ok := index[roleID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	userIDs, err := roleUserIDs(index.descendants([]uint{roleID}))
+	if err != nil {
+		return err
+	}
+
+	if err := managers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Role{}).Where("parent_id = ?", roleID).Update("parent_id", role.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Role{}, roleID).Error
+	}); err != nil {
+		return err
+	}
+
+	return InvalidatePermissions(ctx, userIDs...)
+}
+
+// RoleTree 以树形返回全部角色，Children 中为继承自该角色的子角色
+func RoleTree() ([]*Role, error) {
+	index, err := loadRoleIndex(managers.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var roots []*Role
+	for _, id := range ids {
+		role := index[id]
+
+		var parent *Role
+		if role.ParentID != nil {
+			parent = index[*role.ParentID]
+		}
+
+		// 父角色已删除或处于环中时作为根节点展示
+		if parent == nil || index.inCycle(role.ID) {
+			roots = append(roots, role)
+			continue
+		}
+		parent.Children = append(parent.Children, role)
+	}
+
+	return roots, nil
+}
+
+// roleUserIDs 拥有任一给定角色的用户
+func roleUserIDs(roleIDs []uint) ([]string, error) {
+	var userIDs []uint
+	if err := managers.DB.Table("user_roles").
+		Where("role_id IN ?", roleIDs).
+		Distinct().
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = managers.IDToString(id)
+	}
+	return ids, nil
+}
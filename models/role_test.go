@@ -0,0 +1,133 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+// newRoleIndex 按 子角色 → 父角色 的对应关系构造索引，父角色为 0 表示没有父角色
+func newRoleIndex(parents map[uint]uint) roleIndex {
+	index := roleIndex{}
+	for id, parent := range parents {
+		role := &Role{ID: id}
+		if parent != 0 {
+			role.ParentID = &parent
+		}
+		index[id] = role
+	}
+	return index
+}
+
+func roleIDs(roles []*Role) []uint {
+	ids := make([]uint, len(roles))
+	for i, role := range roles {
+		ids[i] = role.ID
+	}
+	return ids
+}
+
+func TestRoleAncestors(t *testing.T) {
+	tests := []struct {
+		name    string
+		parents map[uint]uint
+		id      uint
+		want    []uint
+	}{
+		{"no parent", map[uint]uint{1: 0}, 1, []uint{}},
+		{"chain", map[uint]uint{1: 0, 2: 1, 3: 2}, 3, []uint{2, 1}},
+		{"deleted parent ends chain", map[uint]uint{2: 1, 3: 2}, 3, []uint{2}},
+		{"unknown role", map[uint]uint{1: 0}, 9, []uint{}},
+		{"self loop", map[uint]uint{1: 1}, 1, []uint{}},
+		{"cycle through role", map[uint]uint{1: 3, 2: 1, 3: 2}, 1, []uint{3, 2}},
+		{"cycle above role", map[uint]uint{1: 2, 2: 3, 3: 2}, 1, []uint{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roleIDs(newRoleIndex(tt.parents).ancestors(tt.id)); !slices.Equal(got, tt.want) {
+				t.Errorf("ancestors(%d) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleInCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		parents map[uint]uint
+		id      uint
+		want    bool
+	}{
+		{"no parent", map[uint]uint{1: 0}, 1, false},
+		{"chain", map[uint]uint{1: 0, 2: 1, 3: 2}, 3, false},
+		{"self loop", map[uint]uint{1: 1}, 1, true},
+		{"two roles", map[uint]uint{1: 2, 2: 1}, 1, true},
+		{"three roles", map[uint]uint{1: 3, 2: 1, 3: 2}, 2, true},
+		{"leads into cycle but not part of it", map[uint]uint{1: 2, 2: 3, 3: 2}, 1, false},
+		{"deleted parent", map[uint]uint{2: 1}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRoleIndex(tt.parents).inCycle(tt.id); got != tt.want {
+				t.Errorf("inCycle(%d) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleCreatesCycle(t *testing.T) {
+	// 1 ← 2 ← 3，4 独立
+	parents := map[uint]uint{1: 0, 2: 1, 3: 2, 4: 0}
+
+	tests := []struct {
+		name   string
+		role   uint
+		parent uint
+		want   bool
+	}{
+		{"own parent", 1, 1, true},
+		{"direct child as parent", 1, 2, true},
+		{"grandchild as parent", 1, 3, true},
+		{"ancestor as parent", 3, 1, false},
+		{"unrelated role", 4, 3, false},
+		{"reparent into other branch", 3, 4, false},
+		{"current parent again", 3, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newRoleIndex(parents).createsCycle(tt.role, tt.parent); got != tt.want {
+				t.Errorf("createsCycle(%d, %d) = %v, want %v", tt.role, tt.parent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleDescendants(t *testing.T) {
+	// 1 ← 2 ← 3，1 ← 4，5 独立，6 和 7 互为父角色
+	index := newRoleIndex(map[uint]uint{1: 0, 2: 1, 3: 2, 4: 1, 5: 0, 6: 7, 7: 6})
+
+	tests := []struct {
+		name string
+		ids  []uint
+		want []uint
+	}{
+		{"root", []uint{1}, []uint{1, 2, 3, 4}},
+		{"middle", []uint{2}, []uint{2, 3}},
+		{"leaf", []uint{3}, []uint{3}},
+		{"several roots", []uint{2, 5}, []uint{2, 3, 5}},
+		{"cycle", []uint{6}, []uint{6, 7}},
+		{"unknown role", []uint{9}, []uint{9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := index.descendants(tt.ids)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("descendants(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
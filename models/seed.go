@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"log/slog"
 	"server-go/managers"
 )
@@ -17,6 +18,22 @@ func SeedDatabase() {
 		{Name: "edit_content", Description: "编辑内容"},
 		{Name: "delete_content", Description: "删除内容"},
 		{Name: "system_settings", Description: "系统设置"},
+		{Name: "manage_oauth_clients", Description: "管理 OAuth 客户端"},
+		{Name: "impersonate_users", Description: "以用户身份登录"},
+		{Name: "manage_policies", Description: "管理授权策略"},
+		{Name: "manage_organizations", Description: "管理所有组织"},
+		{Name: "org:members:read", Description: "查看组织成员和角色"},
+		{Name: "org:members:manage", Description: "管理组织成员"},
+		{Name: "org:roles:manage", Description: "管理组织角色"},
+	}
+
+	// 组织内权限所在的命名空间
+	var namespace PermissionNamespace
+	if err := managers.DB.Where("name = ?", "org").First(&namespace).Error; err != nil {
+		namespace = PermissionNamespace{Name: "org", Description: "组织内权限"}
+		if err := managers.DB.Create(&namespace).Error; err != nil {
+			slog.Error("Failed to create permission namespace", "name", namespace.Name, "err", err)
+		}
 	}
 
 	for _, perm := range permissions {
@@ -49,9 +66,9 @@ func SeedDatabase() {
 		slog.Info("Admin role already exists")
 	}
 
-	// 为管理员角色分配所有权限
+	// 为管理员角色分配所有权限，拒绝条目除外
 	var allPermissions []Permission
-	managers.DB.Find(&allPermissions)
+	managers.DB.Where("name NOT LIKE ?", PermissionDenyPrefix+"%").Find(&allPermissions)
 
 	if err := managers.DB.Model(&adminRole).Association("Permission").Replace(&allPermissions); err != nil {
 		slog.Error("Failed to assign permissions to admin role", "err", err)
@@ -59,6 +76,11 @@ func SeedDatabase() {
 		slog.Info("Assigned all permissions to admin role", "count", len(allPermissions))
 	}
 
+	// 新增的权限要让已缓存的管理员立即生效
+	if err := InvalidateRolePermissions(context.Background(), adminRole.ID); err != nil {
+		slog.Error("Failed to invalidate permission cache", "err", err)
+	}
+
 	// 查找 admin 用户
 	var adminUser User
 	if err := managers.DB.Where("username = ?", "admin").First(&adminUser).Error; err != nil {
@@ -71,6 +93,9 @@ func SeedDatabase() {
 		slog.Error("Failed to assign admin role to admin user", "err", err)
 	} else {
 		slog.Info("Assigned admin role to admin user")
+		if err := InvalidatePermissions(context.Background(), managers.IDToString(adminUser.ID)); err != nil {
+			slog.Error("Failed to invalidate permission cache", "err", err)
+		}
 	}
 
 	// 验证用户权限
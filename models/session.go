@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"server-go/managers"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	Current    bool      `json:"current"`
+	// Impersonated 管理员以该用户身份登录的会话
+	Impersonated bool `json:"impersonated,omitempty"`
+	// OrganizationID 会话当前所选的组织
+	OrganizationID string `json:"organizationId,omitempty"`
+}
+
+// SessionID 会话对外展示的 ID，避免把令牌本身返回给前端
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sessionTouchInterval 最后活跃时间的写入间隔，避免每个请求都写一次 Redis
+const sessionTouchInterval = time.Minute
+
+// setSessionField 只在会话仍存在时写入字段。会话在读取后恰好过期时，
+// 直接 HSET 会重新创建一个没有过期时间的键
+var setSessionField = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// TouchSession 刷新会话的最后活跃时间，seen 为会话中已记录的时间，距今不足一分钟时不写入
+func TouchSession(ctx context.Context, token string, seen string) error {
+	now := time.Now()
+	if last, err := strconv.ParseInt(seen, 10, 64); err == nil && now.Sub(time.Unix(last, 0)) < sessionTouchInterval {
+		return nil
+	}
+
+	return setSessionField.Run(ctx, managers.Redis, []string{managers.TOKEN + token}, "seen", now.Unix()).Err()
+}
+
+// ListSessions 列出用户的有效会话，顺带清理索引中已过期的令牌
+func ListSessions(ctx context.Context, userID string, currentToken string) ([]Session, error) {
+	tokens, err := managers.Redis.SMembers(ctx, managers.SESSIONS+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		fields, err := managers.Redis.HGetAll(ctx, managers.TOKEN+token).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) == 0 || fields["id"] != userID {
+			managers.Redis.SRem(ctx, managers.SESSIONS+userID, token)
+			continue
+		}
+
+		created, _ := strconv.ParseInt(fields["created"], 10, 64)
+		seen, _ := strconv.ParseInt(fields["seen"], 10, 64)
+
+		sessions = append(sessions, Session{
+			ID:             SessionID(token),
+			IP:             fields["ip"],
+			UserAgent:      fields["ua"],
+			CreatedAt:      time.Unix(created, 0),
+			LastSeenAt:     time.Unix(seen, 0),
+			Current:        token == currentToken,
+			Impersonated:   fields["imp"] != "",
+			OrganizationID: fields["org"],
+		})
+	}
+
+	return sessions, nil
+}
+
+// SelectSessionOrganization 在会话中记录所选组织，organizationID 为空时取消选择
+func SelectSessionOrganization(ctx context.Context, token string, organizationID string) error {
+	if organizationID == "" {
+		return managers.Redis.HDel(ctx, managers.TOKEN+token, "org").Err()
+	}
+	return setSessionField.Run(ctx, managers.Redis, []string{managers.TOKEN + token}, "org", organizationID).Err()
+}
+
+// RevokeToken 吊销单个会话
+func RevokeToken(ctx context.Context, userID string, token string) error {
+	if err := managers.Redis.Del(ctx, managers.TOKEN+token).Err(); err != nil {
+		return err
+	}
+	return managers.Redis.SRem(ctx, managers.SESSIONS+userID, token).Err()
+}
+
+// RevokeSession 按会话 ID 吊销，返回是否找到该会话
+func RevokeSession(ctx context.Context, userID string, sessionID string) (bool, error) {
+	tokens, err := managers.Redis.SMembers(ctx, managers.SESSIONS+userID).Result()
+	if err != nil {
+		return false, err
+	}
+
+	for _, token := range tokens {
+		if SessionID(token) == sessionID {
+			return true, RevokeToken(ctx, userID, token)
+		}
+	}
+
+	return false, nil
+}
+
+// RevokeOtherTokens 吊销除当前会话外的全部会话
+func RevokeOtherTokens(ctx context.Context, userID string, currentToken string) (int, error) {
+	tokens, err := managers.Redis.SMembers(ctx, managers.SESSIONS+userID).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, token := range tokens {
+		if token == currentToken {
+			continue
+		}
+		if err := RevokeToken(ctx, userID, token); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// RevokeAllTokens 吊销用户的全部会话，包括刷新令牌
+func RevokeAllTokens(ctx context.Context, userID string) error {
+	if err := RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	return RevokeAllPersonalTokens(userID)
+}
+
+// RevokeAllSessions 吊销用户的全部登录会话和刷新令牌，保留个人访问令牌
+func RevokeAllSessions(ctx context.Context, userID string) error {
+	tokens, err := managers.Redis.SMembers(ctx, managers.SESSIONS+userID).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		keys = append(keys, managers.TOKEN+token)
+	}
+	keys = append(keys, managers.SESSIONS+userID)
+
+	if err := managers.Redis.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	return RevokeAllRefreshTokens(ctx, userID)
+}
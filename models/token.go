@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"server-go/managers"
+	"server-go/utils"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrRefreshInvalid = errors.New("refresh token is invalid or has expired")
+	ErrRefreshReused  = errors.New("refresh token has already been used")
+)
+
+func refreshTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAccessToken 签发短期的 JWT 访问令牌，organizationID 不为空时带上所选组织
+func NewAccessToken(userID string, organizationID string) (string, error) {
+	now := time.Now()
+
+	claims := map[string]interface{}{
+		"iss": managers.Config.ServerURL,
+		"sub": userID,
+		"iat": now.Unix(),
+		"exp": now.Add(managers.AccessTokenLife()).Unix(),
+		"jti": utils.RandomURLBase64(12),
+	}
+	if organizationID != "" {
+		claims["org"] = organizationID
+	}
+
+	return utils.JWTSign(managers.JWTKey, managers.JWTKeyID, utils.JWTTypeAccess, claims)
+}
+
+// VerifyAccessToken 离线校验访问令牌，返回用户 ID 和所选组织
+func VerifyAccessToken(token string) (string, string, error) {
+	header, claims, err := utils.JWTVerify(token, managers.JWTPublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	// ID Token 同样由本站签名，typ 不是 at+jwt 的一律拒绝
+	if header.Typ != utils.JWTTypeAccess {
+		return "", "", utils.ErrJWTMalformed
+	}
+
+	if iss, _ := claims["iss"].(string); iss != managers.Config.ServerURL {
+		return "", "", utils.ErrJWTSignature
+	}
+
+	// 签给第三方客户端的令牌（带 client_id 或 aud）不能用于访问本站接口
+	if _, ok := claims["client_id"]; ok {
+		return "", "", utils.ErrJWTSignature
+	}
+	if _, ok := claims["aud"]; ok {
+		return "", "", utils.ErrJWTSignature
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return "", "", utils.ErrJWTMalformed
+	}
+
+	org, _ := claims["org"].(string)
+	return sub, org, nil
+}
+
+// NewRefreshToken 开启新的刷新令牌家族，Redis 中只保存令牌的哈希
+func NewRefreshToken(ctx context.Context, userID string) (string, error) {
+	family := utils.RandomURLBase64(12)
+
+	if err := managers.Redis.SAdd(ctx, managers.REFRESHUSER+userID, family).Err(); err != nil {
+		return "", err
+	}
+
+	return issueRefreshToken(ctx, userID, family, time.Now())
+}
+
+// issueRefreshToken 在家族内签发新令牌。
+// 家族的总寿命从 created 起算，轮换只会缩短剩余时间，不会无限续期。
+func issueRefreshToken(ctx context.Context, userID string, family string, created time.Time) (string, error) {
+	life := time.Until(created.Add(managers.RefreshTokenLife()))
+	if life <= 0 {
+		return "", ErrRefreshInvalid
+	}
+
+	token := utils.RandomURLBase64(32)
+	hash := refreshTokenHash(token)
+
+	if err := utils.HSetAndExpireNonatomic(managers.Redis, ctx, managers.REFRESH+hash, map[string]interface{}{
+		"id":      userID,
+		"family":  family,
+		"created": created.Unix(),
+		"used":    0,
+	}, life); err != nil {
+		return "", err
+	}
+
+	if err := managers.Redis.SAdd(ctx, managers.REFRESHFAMILY+family, hash).Err(); err != nil {
+		return "", err
+	}
+	managers.Redis.Expire(ctx, managers.REFRESHFAMILY+family, life)
+	// 用户索引需要覆盖所有家族，每次签发都续到最长寿命
+	managers.Redis.Expire(ctx, managers.REFRESHUSER+userID, managers.RefreshTokenLife())
+
+	return token, nil
+}
+
+// RotateRefreshToken 用旧刷新令牌换取新令牌。
+// 已使用过的令牌再次出现说明可能被盗用，整个家族随即作废。
+func RotateRefreshToken(ctx context.Context, token string) (string, string, error) {
+	key := managers.REFRESH + refreshTokenHash(token)
+
+	fields, err := managers.Redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(fields) == 0 {
+		return "", "", ErrRefreshInvalid
+	}
+
+	used, err := managers.Redis.HIncrBy(ctx, key, "used", 1).Result()
+	if err != nil {
+		return "", "", err
+	}
+
+	userID, family := fields["id"], fields["family"]
+
+	if used > 1 {
+		if err := revokeRefreshFamily(ctx, userID, family); err != nil {
+			return "", "", err
+		}
+		return userID, "", ErrRefreshReused
+	}
+
+	// 旧版本签发的令牌没有 created，从本次轮换开始计算家族寿命
+	created := time.Now()
+	if unix, err := strconv.ParseInt(fields["created"], 10, 64); err == nil {
+		created = time.Unix(unix, 0)
+	}
+
+	refresh, err := issueRefreshToken(ctx, userID, family, created)
+	if err == ErrRefreshInvalid {
+		// 家族已到总寿命上限，作废剩余令牌，用户需要重新登录
+		if err := revokeRefreshFamily(ctx, userID, family); err != nil {
+			return "", "", err
+		}
+		return userID, "", ErrRefreshInvalid
+	}
+	return userID, refresh, err
+}
+
+// RevokeRefreshToken 作废刷新令牌所在的整个家族
+func RevokeRefreshToken(ctx context.Context, token string) error {
+	fields, err := managers.Redis.HGetAll(ctx, managers.REFRESH+refreshTokenHash(token)).Result()
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return ErrRefreshInvalid
+	}
+
+	return revokeRefreshFamily(ctx, fields["id"], fields["family"])
+}
+
+// RevokeAllRefreshTokens 作废用户的全部刷新令牌
+func RevokeAllRefreshTokens(ctx context.Context, userID string) error {
+	families, err := managers.Redis.SMembers(ctx, managers.REFRESHUSER+userID).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if err := revokeRefreshFamily(ctx, userID, family); err != nil {
+			return err
+		}
+	}
+
+	return managers.Redis.Del(ctx, managers.REFRESHUSER+userID).Err()
+}
+
+func revokeRefreshFamily(ctx context.Context, userID string, family string) error {
+	hashes, err := managers.Redis.SMembers(ctx, managers.REFRESHFAMILY+family).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(hashes)+1)
+	for _, hash := range hashes {
+		keys = append(keys, managers.REFRESH+hash)
+	}
+	keys = append(keys, managers.REFRESHFAMILY+family)
+
+	if err := managers.Redis.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	return managers.Redis.SRem(ctx, managers.REFRESHUSER+userID, family).Err()
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"server-go/managers"
+	"server-go/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TOTPIssuer        = "binran"
+	RecoveryCodeCount = 10
+	PendingLoginLife  = 5 * time.Minute
+	PendingLoginTries = 5
+)
+
+type RecoveryCode struct {
+	ID     uint   `gorm:"primary_key"`
+	UserID uint   `gorm:"index;not null"`
+	Hash   []byte `gorm:"not null"`
+	UsedAt *time.Time
+}
+
+func TwoFactorInit() {
+	managers.DB.AutoMigrate(&RecoveryCode{})
+}
+
+// RequiresTwoFactor 用户是否持有要求两步验证的角色，需先加载 Role
+func (user *User) RequiresTwoFactor() bool {
+	for _, role := range user.EffectiveRoles() {
+		if role.RequireTwoFactor {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyTOTP 校验用户的动态验证码，同一验证码在有效期内只能使用一次
+func (user *User) VerifyTOTP(ctx context.Context, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+
+	counter, ok := utils.TOTPValidate(user.TOTPSecret, code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	key := managers.TOTPUSED + managers.IDToString(user.ID) + ":" + strconv.FormatUint(counter, 10)
+	fresh, err := managers.Redis.SetNX(ctx, key, 1, 3*utils.TOTPPeriod*time.Second).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return fresh, nil
+}
+
+// NewRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (user *User) NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code := strings.ToLower(utils.RandomString(10))
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = RecoveryCode{UserID: user.ID, Hash: recoveryCodeHash(codes[i])}
+	}
+
+	err := managers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+
+	return codes, err
+}
+
+// UseRecoveryCode 消耗一个恢复码
+func (user *User) UseRecoveryCode(code string) (bool, error) {
+	now := time.Now()
+	result := managers.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", user.ID, recoveryCodeHash(code)).
+		Update("used_at", &now)
+
+	return result.RowsAffected == 1, result.Error
+}
+
+// DisableTwoFactor 关闭两步验证并清除恢复码
+func (user *User) DisableTwoFactor() error {
+	return managers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":  "",
+			"totp_enabled": false,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+func recoveryCodeHash(code string) []byte {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return sum[:]
+}
+
+// NewPendingLogin 密码校验通过但还需第二步验证时，签发短期的待定登录令牌
+func NewPendingLogin(ctx context.Context, userID string) (string, error) {
+	token := TokenMaker()
+
+	if err := utils.HSetAndExpireNonatomic(managers.Redis, ctx, managers.PENDINGLOGIN+token, map[string]interface{}{"id": userID, "tries": 0}, PendingLoginLife); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// PendingLoginUser 读取待定登录令牌对应的用户，并累计尝试次数
+func PendingLoginUser(ctx context.Context, token string) (string, int64, error) {
+	key := managers.PENDINGLOGIN + token
+
+	id, err := managers.Redis.HGet(ctx, key, "id").Result()
+	if err != nil {
+		return "", 0, err
+	}
+
+	tries, err := managers.Redis.HIncrBy(ctx, key, "tries", 1).Result()
+	return id, tries, err
+}
+
+// ClosePendingLogin 作废待定登录令牌
+func ClosePendingLogin(ctx context.Context, token string) error {
+	return managers.Redis.Del(ctx, managers.PENDINGLOGIN+token).Err()
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"server-go/managers"
+	"server-go/utils"
+	"strings"
+	"time"
+)
+
+const WebAuthnChallengeLife = 5 * time.Minute
+
+type WebAuthnCredential struct {
+	ID           uint       `gorm:"primary_key" json:"id"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"-"`
+	UserID       uint       `gorm:"index;not null" json:"-"`
+	CredentialID []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey    []byte     `gorm:"not null" json:"-"`
+	Algorithm    int64      `json:"algorithm"`
+	SignCount    uint32     `json:"-"`
+	Name         string     `gorm:"size:50" json:"name"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+func WebAuthnInit() {
+	managers.DB.AutoMigrate(&WebAuthnCredential{})
+}
+
+// WebAuthnRPID 依赖方 ID，即站点域名
+func WebAuthnRPID() string {
+	return managers.Config.Domain
+}
+
+// WebAuthnOrigin 检查 clientDataJSON 中的 origin 是否为前端站点
+func WebAuthnOrigin(origin string) bool {
+	return origin != "" && origin == strings.TrimSuffix(managers.Config.WebURL, "/")
+}
+
+// WebAuthnUserHandle 用户句柄，注册时写入认证器，免用户名登录时原样返回
+func WebAuthnUserHandle(userID uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(managers.IDToString(userID)))
+}
+
+// NewWebAuthnChallenge 生成挑战并存入 Redis，value 为挑战绑定的用户 ID（可为空）
+func NewWebAuthnChallenge(ctx context.Context, prefix string, userID string) (string, error) {
+	challenge := base64.RawURLEncoding.EncodeToString(utils.RandomBytes(32))
+
+	if err := managers.Redis.Set(ctx, prefix+challenge, userID, WebAuthnChallengeLife).Err(); err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// TakeWebAuthnChallenge 取出并作废挑战，返回其绑定的用户 ID
+func TakeWebAuthnChallenge(ctx context.Context, prefix string, challenge string) (string, error) {
+	return managers.Redis.GetDel(ctx, prefix+challenge).Result()
+}
@@ -1,7 +1,6 @@
 package routers
 
 import (
-	"bytes"
 	"log/slog"
 	"net/http"
 	"server-go/managers"
@@ -18,7 +17,7 @@ const accountParty = "/account"
 func account() {
 	models.AccountInit()
 
-	http.Handle(accountParty+"/renew", utils.CORS(verify(http.HandlerFunc(handleRenew)), http.MethodPut))
+	http.Handle(accountParty+"/renew", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleRenew))), http.MethodPut))
 
 	http.Handle(accountParty+"/register", utils.CORS(http.HandlerFunc(handleRegister), http.MethodPost))
 	http.Handle(accountParty+"/login", utils.CORS(http.HandlerFunc(handleLogin), http.MethodPost))
@@ -27,8 +26,14 @@ func account() {
 	// 用户信息管理
 	http.Handle(accountParty+"/info", utils.CORS(verify(http.HandlerFunc(handleGetUserInfo)), http.MethodGet))
 	http.Handle(accountParty+"/permissions", utils.CORS(verify(http.HandlerFunc(handleGetUserPermissions)), http.MethodGet))
-	http.Handle(accountParty+"/update", utils.CORS(verify(http.HandlerFunc(handleUpdateUserInfo)), http.MethodPut))
-	http.Handle(accountParty+"/password", utils.CORS(verify(http.HandlerFunc(handleChangePassword)), http.MethodPut))
+	http.Handle(accountParty+"/update", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleUpdateUserInfo))), http.MethodPut))
+	http.Handle(accountParty+"/password", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleChangePassword))), http.MethodPut))
+	http.Handle(accountParty+"/password/forgot", utils.CORS(http.HandlerFunc(handleForgotPassword), http.MethodPost))
+	http.Handle(accountParty+"/password/reset", utils.CORS(http.HandlerFunc(handleResetPassword), http.MethodPost))
+
+	// 邮箱验证
+	http.Handle(accountParty+"/email/verify", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleSendEmailVerification))), http.MethodPost))
+	http.Handle(models.EmailConfirmPath, utils.CORS(http.HandlerFunc(handleConfirmEmail), http.MethodGet))
 
 	// 头像管理
 	http.Handle(accountParty+"/avatar", utils.CORS(verify(http.HandlerFunc(handleGetAvatar)), http.MethodGet))
@@ -46,7 +51,7 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	username := r.PostFormValue("username")
 	password := r.PostFormValue("password")
 	// phoneNumber := r.PostFormValue("phoneNumber")
-	// email := r.PostFormValue("email")
+	email := r.PostFormValue("email")
 	sexStr := r.PostFormValue("sex")
 
 	var sex uint64
@@ -68,19 +73,50 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !passChallenge(w, r, models.ChallengeRegister) {
+		return
+	}
+
+	if email != "" {
+		var err error
+		if email, err = models.NormalizeEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	user := models.User{
 		Username: username,
 		Sex:      uint8(sex),
 	}
 
+	if err := models.ValidatePassword(&user, password); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
 	user.SetPassword(password)
 
-	if err := managers.DB.Create(&user).Error; err != nil {
-		slog.Error(utils.DBErrorString, "err", err)
-		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+	if err := models.RegisterUser(&user, email, r.PostFormValue("invite")); err != nil {
+		switch err {
+		case models.ErrRegistrationClosed, models.ErrEmailDomain, models.ErrInviteInvalid:
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case models.ErrEmailTaken:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
 		return
 	}
 
+	// 邮箱在确认后才写入
+	if email != "" && !user.EmailVerified {
+		if err := models.SendEmailVerification(r.Context(), &user, email); err != nil {
+			slog.Error("Failed to send verification email", "err", err)
+		}
+	}
+
 	utils.SucessWithData(w, user)
 }
 
@@ -94,10 +130,14 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !passChallenge(w, r, models.ChallengeLogin) {
+		return
+	}
+
 	ip := utils.ParseIP(r)
 	ipKey := managers.IPLIMIT + ip
 
-	reply, err := utils.IncreaseAndExpireNonatomic(managers.Redis, r.Context(), ipKey, time.Hour)
+	reply, err := utils.IncreaseAndExpireNonatomic(managers.Redis, r.Context(), ipKey, time.Duration(managers.Config.Login.IPWindow)*time.Second)
 	if err != nil {
 		msg := "Failed to determine if the ip hasbeen frozen"
 		slog.Error(msg, "err", err)
@@ -105,32 +145,51 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if reply > 5 {
+	if reply > managers.Config.Login.IPLimit {
 		msg := "You are logged in top often. Please try again later."
 		slog.Error(msg, "ip", ip)
 		http.Error(w, msg, http.StatusTooManyRequests)
 		return
 	}
 
+	// 按用户名退避或锁定，账号不存在时同样计数，响应保持一致
+	if loginThrottled(w, r, &models.LoginEvent{Username: username, Method: models.LoginMethodPassword}) {
+		return
+	}
+
 	user := models.User{Username: username}
 	if err := managers.DB.
 		Select("id", "salt", "password").
 		Where(&user).
-		First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			msg := "username or password is wrong"
-			slog.Error(msg, "username", username)
-			http.Error(w, msg, http.StatusBadRequest)
-		} else {
-			slog.Error(utils.DBErrorString, "err", err)
-			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
-		}
+		First(&user).Error; err != nil && err != gorm.ErrRecordNotFound {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
 		return
 	}
 
-	if !bytes.Equal(user.Password, models.PasswordMaker(password, user.Salt)) {
+	ok, rehash := user.CheckPassword(password)
+	if !ok {
+		models.RecordLoginEvent(r, &models.LoginEvent{
+			UserID:   user.ID,
+			Username: username,
+			Type:     models.EventLogin,
+			Outcome:  models.OutcomeFailure,
+			Method:   models.LoginMethodPassword,
+		})
+
+		if err := models.RecordLoginFailure(r.Context(), username); err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+		if managers.Config.Challenge.Enabled {
+			if err := models.RecordChallengeFailure(r.Context(), ip); err != nil {
+				slog.Error(utils.CacheErrorString, "err", err)
+			}
+		}
+
 		msg := "username or password is wrong"
-		slog.Error(msg, "username", username)
+		slog.Error(msg, "username", username, "ip", ip)
 		http.Error(w, msg, http.StatusBadRequest)
 		return
 	}
@@ -141,10 +200,118 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := managers.Redis.Del(r.Context(), ipKey).Err(); err != nil {
-		msg := "Failed to delete ipKey"
-		slog.Error(msg, "err", err)
-		http.Error(w, msg, http.StatusInternalServerError)
+	// 旧算法或旧参数的哈希顺带升级，失败不影响本次登录
+	if rehash {
+		if err := user.RehashPassword(password); err != nil {
+			slog.Error("Failed to rehash password", "id", user.ID, "err", err)
+		}
+	}
+
+	if user.Suspended() {
+		event := models.UserEvent(managers.IDToString(user.ID), models.EventLogin, models.OutcomeBlocked)
+		event.Username, event.Method, event.Detail = user.Username, models.LoginMethodPassword, "suspended"
+		models.RecordLoginEvent(r, event)
+
+		http.Error(w, models.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 已开启两步验证，先签发待定登录令牌
+	if user.TOTPEnabled {
+		if loginThrottled(w, r, &models.LoginEvent{UserID: user.ID, Username: user.Username, Method: models.LoginMethodPassword}) {
+			return
+		}
+
+		pendingToken, err := models.NewPendingLogin(r.Context(), managers.IDToString(user.ID))
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		event := models.UserEvent(managers.IDToString(user.ID), models.EventTwoFactor, models.OutcomeIssued)
+		event.Username, event.Method = user.Username, models.LoginMethodPassword
+		models.RecordLoginEvent(r, event)
+
+		utils.SucessWithData(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
+		return
+	}
+
+	finishLogin(w, r, &user, ip, models.LoginMethodPassword)
+}
+
+// loginThrottled 用户名因多次失败处于退避或锁定期时写回 429 并返回 true。
+// 密码和两步验证码的失败都计入同一用户名，签发待定登录令牌前也要检查，避免换一个令牌继续猜验证码
+func loginThrottled(w http.ResponseWriter, r *http.Request, event *models.LoginEvent) bool {
+	wait, err := models.LoginThrottle(r.Context(), event.Username)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	event.Type, event.Outcome, event.Detail = models.EventLogin, models.OutcomeBlocked, "throttled"
+	models.RecordLoginEvent(r, event)
+
+	msg := "Too many failed attempts. Please try again later."
+	slog.Error(msg, "username", event.Username, "ip", utils.ParseIP(r), "wait", wait)
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	http.Error(w, msg, http.StatusTooManyRequests)
+	return true
+}
+
+// finishLogin 签发会话并返回用户信息，method 为本次登录使用的验证方式，写入登录记录。
+// 开启 JWT 模式且客户端传 mode=token 时，改为返回访问令牌和刷新令牌
+func finishLogin(w http.ResponseWriter, r *http.Request, user *models.User, ip string, method string) {
+	event := models.UserEvent(managers.IDToString(user.ID), models.EventLogin, models.OutcomeSuccess)
+	event.Username, event.Method = user.Username, method
+
+	// 按域名注册的账号需要先确认邮箱
+	if user.EmailPending {
+		event.Outcome, event.Detail = models.OutcomeBlocked, "email pending"
+		models.RecordLoginEvent(r, event)
+		http.Error(w, "Confirm your email address before signing in", http.StatusForbidden)
+		return
+	}
+
+	if user.Suspended() {
+		event.Outcome, event.Detail = models.OutcomeBlocked, "suspended"
+		models.RecordLoginEvent(r, event)
+		http.Error(w, models.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 管理员要求修改密码或密码已过期时不签发会话，改为返回一次性重置令牌
+	if user.MustChangePassword || user.PasswordIsExpired() {
+		token, err := models.NewPasswordResetToken(r.Context(), managers.IDToString(user.ID))
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		event.Outcome, event.Detail = models.OutcomeBlocked, "password change required"
+		models.RecordLoginEvent(r, event)
+
+		utils.SucessWithData(w, map[string]interface{}{
+			"passwordResetRequired": true,
+			"resetToken":            token,
+		})
+		return
+	}
+
+	if managers.Config.JWT.Enabled && r.PostFormValue("mode") == "token" {
+		event.Detail = "token"
+		models.RecordLoginEvent(r, event)
+		if issueTokenPair(w, r, user) {
+			clearLoginFailures(r, user, ip)
+		}
 		return
 	}
 
@@ -154,6 +321,9 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	models.RecordLoginEvent(r, event)
+	clearLoginFailures(r, user, ip)
+
 	if err := utils.SucessWithData(w, user); err != nil {
 		slog.Error(utils.ReturnFailedString, "err", err)
 		http.Error(w, utils.ReturnFailedString, http.StatusInternalServerError)
@@ -161,10 +331,22 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// clearLoginFailures 登录完成后清除该 IP 和用户名的失败计数。
+// 只校验了密码、第二步尚未通过时不能清除，否则知道密码就能绕过锁定。
+// 会话已经签发，清除失败只记录日志，计数到期后自然失效
+func clearLoginFailures(r *http.Request, user *models.User, ip string) {
+	if err := managers.Redis.Del(r.Context(), managers.IPLIMIT+ip).Err(); err != nil {
+		slog.Error("Failed to delete ipKey", "err", err)
+	}
+	if err := models.ResetLoginFailures(r.Context(), user.Username); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+	}
+}
+
 func handleLogout(w http.ResponseWriter, r *http.Request) {
-	token, _ := r.Cookie("token")
+	token := r.Context().Value(SessionToken).(string)
 
-	if err := managers.Redis.Expire(r.Context(), managers.TOKEN+token.Value, -1).Err(); err != nil {
+	if err := models.RevokeToken(r.Context(), r.Context().Value(UserID).(string), token); err != nil {
 		msg := "Expire token filed"
 		slog.Error(msg, "err", err)
 		http.Error(w, msg, http.StatusInternalServerError)
@@ -174,6 +356,7 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 	models.SetCookie(w, r, &http.Cookie{Name: "token", Value: "", Path: "/", Expires: time.Now()})
 	models.SetCookie(w, r, &http.Cookie{Name: "auth_status", Value: "0", Path: "/", Expires: time.Now()})
 
+	models.RecordLoginEvent(r, models.UserEvent(r.Context().Value(UserID).(string), models.EventLogout, models.OutcomeSuccess))
 	utils.Sucess(w)
 }
 
@@ -217,20 +400,21 @@ func handleGetUserPermissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 收集所有权限
+	// 收集所有权限，包括从父角色继承的
 	permissions := make(map[string]bool)
 	for _, perm := range user.Permission {
 		permissions[perm.Name] = true
 	}
-	for _, role := range user.Role {
+	for _, role := range user.EffectiveRoles() {
 		for _, perm := range role.Permission {
 			permissions[perm.Name] = true
 		}
 	}
 
 	result := map[string]interface{}{
-		"roles":       user.Role,
-		"permissions": permissions,
+		"roles":          user.Role,
+		"inheritedRoles": user.InheritedRoles,
+		"permissions":    permissions,
 	}
 
 	utils.SucessWithData(w, result)
@@ -249,26 +433,69 @@ func handleUpdateUserInfo(w http.ResponseWriter, r *http.Request) {
 	if name != "" {
 		updateData["name"] = name
 	}
-	if email != "" {
-		updateData["email"] = email
-	}
 	if phoneNumber != "" {
-		updateData["phone_number"] = phoneNumber
+		phone, err := models.NormalizePhone(phoneNumber)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updateData["phone_number"] = phone
+		// 号码变化时需要重新验证
+		updateData["phone_verified"] = gorm.Expr("phone_verified AND phone_number = ?", phone)
+	}
+
+	if email != "" {
+		var err error
+		if email, err = models.NormalizeEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := models.CheckAccountEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	if len(updateData) == 0 {
+	if len(updateData) == 0 && email == "" {
 		http.Error(w, "No data to update", http.StatusBadRequest)
 		return
 	}
 
 	// 更新数据库
-	if err := managers.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updateData).Error; err != nil {
+	if len(updateData) > 0 {
+		if err := managers.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updateData).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// 获取更新后的用户信息
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
 		slog.Error(utils.DBErrorString, "err", err)
 		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
 		return
 	}
 
-	// 获取更新后的用户信息
+	// 邮箱变更需要通过确认链接生效
+	if email != "" && email != user.Email {
+		if err := models.SendEmailVerification(r.Context(), &user, email); err != nil {
+			msg := "Failed to send verification email"
+			slog.Error(msg, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SucessWithData(w, user)
+}
+
+// 发送邮箱确认链接，不传 email 时重发当前未验证的地址
+func handleSendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+	email := r.PostFormValue("email")
+
 	var user models.User
 	if err := managers.DB.First(&user, userID).Error; err != nil {
 		slog.Error(utils.DBErrorString, "err", err)
@@ -276,7 +503,47 @@ func handleUpdateUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.SucessWithData(w, user)
+	if email == "" {
+		if user.Email == "" || user.EmailVerified {
+			http.Error(w, "No email to verify", http.StatusBadRequest)
+			return
+		}
+		email = user.Email
+	}
+
+	email, err := models.NormalizeEmail(email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SendEmailVerification(r.Context(), &user, email); err != nil {
+		msg := "Failed to send verification email"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 打开确认链接
+func handleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := models.ConfirmEmail(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		switch err {
+		case models.ErrLinkInvalid:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case models.ErrEmailTaken:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{"email": user.Email, "emailVerified": true})
 }
 
 // 修改密码
@@ -291,15 +558,9 @@ func handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证新密码长度
-	if len(newPassword) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
-		return
-	}
-
 	// 获取用户信息
 	var user models.User
-	if err := managers.DB.Select("id", "salt", "password").First(&user, userID).Error; err != nil {
+	if err := managers.DB.Select("id", "username", "salt", "password").First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "User not found", http.StatusNotFound)
 		} else {
@@ -310,24 +571,20 @@ func handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证旧密码
-	if !bytes.Equal(user.Password, models.PasswordMaker(oldPassword, user.Salt)) {
+	if ok, _ := user.CheckPassword(oldPassword); !ok {
+		models.RecordLoginEvent(r, models.UserEvent(userID, models.EventPasswordChange, models.OutcomeFailure))
 		http.Error(w, "Old password is incorrect", http.StatusBadRequest)
 		return
 	}
 
-	// 设置新密码
-	user.SetPassword(newPassword)
-
-	// 更新数据库
-	if err := managers.DB.Model(&user).Updates(map[string]interface{}{
-		"password": user.Password,
-		"salt":     user.Salt,
-	}).Error; err != nil {
-		slog.Error(utils.DBErrorString, "err", err)
-		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+	// 按密码策略设置新密码
+	if err := models.UpdatePassword(&user, newPassword); err != nil {
+		writePasswordError(w, err)
 		return
 	}
 
+	models.RecordLoginEvent(r, models.UserEvent(userID, models.EventPasswordChange, models.OutcomeSuccess))
+
 	utils.Sucess(w)
 }
 
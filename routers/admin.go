@@ -13,24 +13,51 @@ import (
 const adminParty = "/admin"
 
 func admin() {
+	models.StartPermissionInvalidation()
+	models.StartDisabledUserSync()
+
 	// 角色管理
-	http.Handle(adminParty+"/roles", utils.CORS(verify(RequirePermission("manage_roles")(http.HandlerFunc(handleListRoles))), http.MethodGet))
-	http.Handle(adminParty+"/role", utils.CORS(verify(RequirePermission("manage_roles")(http.HandlerFunc(handleCreateRole))), http.MethodPost))
-	http.Handle(adminParty+"/role/update", utils.CORS(verify(RequirePermission("manage_roles")(http.HandlerFunc(handleUpdateRole))), http.MethodPut))
-	http.Handle(adminParty+"/role/delete", utils.CORS(verify(RequirePermission("manage_roles")(http.HandlerFunc(handleDeleteRole))), http.MethodDelete))
+	http.Handle(adminParty+"/roles", utils.CORS(verifyScoped(RequirePermission("manage_roles")(http.HandlerFunc(handleListRoles))), http.MethodGet))
+	http.Handle(adminParty+"/role", utils.CORS(verifyScoped(RequirePermission("manage_roles")(http.HandlerFunc(handleCreateRole))), http.MethodPost))
+	http.Handle(adminParty+"/role/update", utils.CORS(verifyScoped(RequirePermission("manage_roles")(http.HandlerFunc(handleUpdateRole))), http.MethodPut))
+	http.Handle(adminParty+"/role/delete", utils.CORS(verifyScoped(RequirePermission("manage_roles")(http.HandlerFunc(handleDeleteRole))), http.MethodDelete))
 
 	// 权限管理
-	http.Handle(adminParty+"/permissions", utils.CORS(verify(RequirePermission("manage_permissions")(http.HandlerFunc(handleListPermissions))), http.MethodGet))
-	http.Handle(adminParty+"/permission", utils.CORS(verify(RequirePermission("manage_permissions")(http.HandlerFunc(handleCreatePermission))), http.MethodPost))
+	http.Handle(adminParty+"/permissions", utils.CORS(verifyScoped(RequirePermission("manage_permissions")(http.HandlerFunc(handleListPermissions))), http.MethodGet))
+	http.Handle(adminParty+"/permission", utils.CORS(verifyScoped(RequirePermission("manage_permissions")(http.HandlerFunc(handleCreatePermission))), http.MethodPost))
+	http.Handle(adminParty+"/permission-namespaces", utils.CORS(verifyScoped(RequirePermission("manage_permissions")(http.HandlerFunc(handleListPermissionNamespaces))), http.MethodGet))
+	http.Handle(adminParty+"/permission-namespace", utils.CORS(verifyScoped(RequirePermission("manage_permissions")(http.HandlerFunc(handleCreatePermissionNamespace))), http.MethodPost))
+	http.Handle(adminParty+"/permission-namespace/delete", utils.CORS(verifyScoped(RequirePermission("manage_permissions")(http.HandlerFunc(handleDeletePermissionNamespace))), http.MethodDelete))
 
 	// 用户管理
-	http.Handle(adminParty+"/users", utils.CORS(verify(RequirePermission("manage_users")(http.HandlerFunc(handleListUsers))), http.MethodGet))
-	http.Handle(adminParty+"/user/roles", utils.CORS(verify(RequirePermission("manage_users")(http.HandlerFunc(handleAssignUserRoles))), http.MethodPost))
-	http.Handle(adminParty+"/user/permissions", utils.CORS(verify(RequirePermission("manage_users")(http.HandlerFunc(handleAssignUserPermissions))), http.MethodPost))
+	http.Handle(adminParty+"/users", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleListUsers))), http.MethodGet))
+	http.Handle(adminParty+"/user/roles", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleAssignUserRoles))), http.MethodPost))
+	http.Handle(adminParty+"/user/permissions", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleAssignUserPermissions))), http.MethodPost))
+	http.Handle(adminParty+"/user/password", utils.CORS(verifyScoped(RequirePolicy("manage_users", loadUserResource)(http.HandlerFunc(handleSetUserPassword))), http.MethodPut))
+	http.Handle(adminParty+"/user/unlock", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleUnlockUser))), http.MethodPost))
+	http.Handle(adminParty+"/user", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleCreateUser))), http.MethodPost))
+	http.Handle(adminParty+"/user/update", utils.CORS(verifyScoped(RequirePolicy("manage_users", loadUserResource)(http.HandlerFunc(handleUpdateUser))), http.MethodPut))
+	http.Handle(adminParty+"/user/suspend", utils.CORS(verifyScoped(RequirePolicy("manage_users", loadUserResource)(http.HandlerFunc(handleSuspendUser))), http.MethodPost))
+	http.Handle(adminParty+"/user/unsuspend", utils.CORS(verifyScoped(RequirePolicy("manage_users", loadUserResource)(http.HandlerFunc(handleUnsuspendUser))), http.MethodPost))
+	http.Handle(adminParty+"/user/force-reset", utils.CORS(verifyScoped(RequirePolicy("manage_users", loadUserResource)(http.HandlerFunc(handleForcePasswordReset))), http.MethodPost))
+	http.Handle(adminParty+"/user/delete", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleDeleteUser))), http.MethodDelete))
+	http.Handle(adminParty+"/user/restore", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleRestoreUser))), http.MethodPost))
 }
 
-// 获取所有角色
+// 获取所有角色，tree=1 时按继承关系返回角色树
 func handleListRoles(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("tree") == "1" {
+		tree, err := models.RoleTree()
+		if err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		utils.SucessWithData(w, tree)
+		return
+	}
+
 	var roles []models.Role
 	if err := managers.DB.Preload("Permission").Find(&roles).Error; err != nil {
 		slog.Error(utils.DBErrorString, "err", err)
@@ -51,9 +78,28 @@ func handleCreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	parentID, _, err := parseParentID(r)
+	if err != nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	if parentID != nil {
+		if err := managers.DB.First(&models.Role{}, *parentID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, models.ErrRoleParent.Error(), http.StatusBadRequest)
+			} else {
+				slog.Error(utils.DBErrorString, "err", err)
+				http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
 	role := models.Role{
 		Name:        name,
 		Description: description,
+		ParentID:    parentID,
 	}
 
 	if err := managers.DB.Create(&role).Error; err != nil {
@@ -65,37 +111,74 @@ func handleCreateRole(w http.ResponseWriter, r *http.Request) {
 	utils.SucessWithData(w, role)
 }
 
-// 更新角色
+// parseParentID 解析表单中的 parentId，为空或 0 表示没有父角色
+func parseParentID(r *http.Request) (parentID *uint, present bool, err error) {
+	value := r.PostFormValue("parentId")
+	if _, present = r.PostForm["parentId"]; !present || value == "" || value == "0" {
+		return nil, present, nil
+	}
+
+	id, err := managers.StringToID(value)
+	if err != nil {
+		return nil, present, err
+	}
+	return &id, present, nil
+}
+
+// 更新角色，传 parentId 时同时修改父角色
 func handleUpdateRole(w http.ResponseWriter, r *http.Request) {
-	roleID := r.PostFormValue("id")
+	roleID, err := managers.StringToID(r.PostFormValue("id"))
 	description := r.PostFormValue("description")
 
-	if roleID == "" {
+	if err != nil {
 		http.Error(w, "Role ID is required", http.StatusBadRequest)
 		return
 	}
 
+	parentID, setParent, err := parseParentID(r)
+	if err != nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
 	if err := managers.DB.Model(&models.Role{}).Where("id = ?", roleID).Update("description", description).Error; err != nil {
 		slog.Error(utils.DBErrorString, "err", err)
 		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
 		return
 	}
 
+	if setParent {
+		if err := models.SetRoleParent(r.Context(), roleID, parentID); err != nil {
+			if err == models.ErrRoleCycle || err == models.ErrRoleParent {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				msg := "Failed to set parent role"
+				slog.Error(msg, "id", roleID, "err", err)
+				http.Error(w, msg, http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
 	utils.Sucess(w)
 }
 
 // 删除角色
 func handleDeleteRole(w http.ResponseWriter, r *http.Request) {
-	roleID := r.URL.Query().Get("id")
-
-	if roleID == "" {
+	roleID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
 		http.Error(w, "Role ID is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := managers.DB.Delete(&models.Role{}, roleID).Error; err != nil {
-		slog.Error(utils.DBErrorString, "err", err)
-		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+	if err := models.DeleteRole(r.Context(), roleID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Role not found", http.StatusNotFound)
+		} else {
+			msg := "Failed to delete role"
+			slog.Error(msg, "id", roleID, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -114,7 +197,7 @@ func handleListPermissions(w http.ResponseWriter, r *http.Request) {
 	utils.SucessWithData(w, permissions)
 }
 
-// 创建权限
+// 创建权限，可以是 users:read 这样带命名空间的名字、content:* 通配符或 ! 开头的拒绝条目
 func handleCreatePermission(w http.ResponseWriter, r *http.Request) {
 	name := r.PostFormValue("name")
 	description := r.PostFormValue("description")
@@ -124,6 +207,16 @@ func handleCreatePermission(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.ValidatePermissionName(name); err != nil {
+		if err == models.ErrPermissionName || err == models.ErrPermissionNamespace {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
 	permission := models.Permission{
 		Name:        name,
 		Description: description,
@@ -138,6 +231,89 @@ func handleCreatePermission(w http.ResponseWriter, r *http.Request) {
 	utils.SucessWithData(w, permission)
 }
 
+// 获取所有权限命名空间
+func handleListPermissionNamespaces(w http.ResponseWriter, r *http.Request) {
+	var namespaces []models.PermissionNamespace
+	if err := managers.DB.Order("name").Find(&namespaces).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, namespaces)
+}
+
+// 登记权限命名空间
+func handleCreatePermissionNamespace(w http.ResponseWriter, r *http.Request) {
+	namespace := models.PermissionNamespace{
+		Name:        r.PostFormValue("name"),
+		Description: r.PostFormValue("description"),
+	}
+
+	if err := models.ValidateNamespaceName(namespace.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int64
+	if err := managers.DB.Model(&models.PermissionNamespace{}).Where("name = ?", namespace.Name).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Namespace already exists", http.StatusConflict)
+		return
+	}
+
+	if err := managers.DB.Create(&namespace).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, namespace)
+}
+
+// 删除权限命名空间，命名空间下还有权限时不能删除
+func handleDeletePermissionNamespace(w http.ResponseWriter, r *http.Request) {
+	namespaceID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Namespace ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var namespace models.PermissionNamespace
+	if err := managers.DB.First(&namespace, namespaceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Namespace not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	count, err := models.NamespacePermissionCount(namespace.Name)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Namespace still has permissions", http.StatusConflict)
+		return
+	}
+
+	if err := managers.DB.Delete(&namespace).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
 // 为用户分配角色
 func handleAssignUserRoles(w http.ResponseWriter, r *http.Request) {
 	userID := r.PostFormValue("userId")
@@ -183,6 +359,12 @@ func handleAssignUserRoles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.InvalidatePermissions(r.Context(), managers.IDToString(user.ID)); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
 	utils.Sucess(w)
 }
 
@@ -231,13 +413,26 @@ func handleAssignUserPermissions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := models.InvalidatePermissions(r.Context(), managers.IDToString(user.ID)); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
 	utils.Sucess(w)
 }
 
 // 获取所有用户
 func handleListUsers(w http.ResponseWriter, r *http.Request) {
+	query := managers.DB.Preload("Role").Preload("Permission")
+
+	// deleted=1 时只列出已软删除、可以恢复的用户
+	if r.URL.Query().Get("deleted") == "1" {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL AND purged_at IS NULL")
+	}
+
 	var users []models.User
-	if err := managers.DB.Preload("Role").Preload("Permission").Find(&users).Error; err != nil {
+	if err := query.Find(&users).Error; err != nil {
 		slog.Error(utils.DBErrorString, "err", err)
 		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
 		return
@@ -245,3 +440,381 @@ func handleListUsers(w http.ResponseWriter, r *http.Request) {
 
 	utils.SucessWithData(w, users)
 }
+
+// 管理员重置用户密码，同样需要满足密码策略
+func handleSetUserPassword(w http.ResponseWriter, r *http.Request) {
+	userID := r.PostFormValue("userId")
+	password := r.PostFormValue("password")
+
+	if userID == "" || password == "" {
+		http.Error(w, "User ID and password are required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Select("id", "username", "salt", "password").First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := models.UpdatePassword(&user, password); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
+	if err := models.RevokeAllTokens(r.Context(), managers.IDToString(user.ID)); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	event := models.UserEvent(userID, models.EventPasswordChange, models.OutcomeSuccess)
+	event.Detail = "set by admin " + r.Context().Value(UserID).(string)
+	models.RecordLoginEvent(r, event)
+
+	slog.Info("Password set by admin", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// 解除用户名的登录锁定和退避
+func handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PostFormValue("username")
+	if username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.ResetLoginFailures(r.Context(), username); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Login lockout cleared", "username", username, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// adminTargetUser 按表单中的 userId 查找用户，找不到时已写回响应
+func adminTargetUser(w http.ResponseWriter, r *http.Request, userID string) (*models.User, bool) {
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// loadUserResource 按表单中的 userId 加载被管理的用户，用于按部门等属性授权
+func loadUserResource(r *http.Request) (*models.Resource, error) {
+	userID, err := managers.StringToID(r.PostFormValue("userId"))
+	if err != nil {
+		return nil, errResourceParams
+	}
+
+	var user models.User
+	if err := managers.DB.Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := user.LoadInheritedRoles(); err != nil {
+		return nil, err
+	}
+
+	return user.PolicyResource(), nil
+}
+
+// 创建用户，初始密码同样需要满足密码策略
+func handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PostFormValue("username")
+	password := r.PostFormValue("password")
+	email := r.PostFormValue("email")
+
+	if username == "" || password == "" {
+		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	user := models.User{
+		Username:   username,
+		Name:       r.PostFormValue("name"),
+		Department: r.PostFormValue("department"),
+		// 由管理员设置的初始密码，首次登录需要修改
+		MustChangePassword: r.PostFormValue("mustChangePassword") != "false",
+	}
+
+	if email != "" {
+		var err error
+		if email, err = models.NormalizeEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if phoneNumber := r.PostFormValue("phoneNumber"); phoneNumber != "" {
+		var err error
+		if user.PhoneNumber, err = models.NormalizePhone(phoneNumber); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := models.ValidatePassword(&user, password); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
+	user.SetPassword(password)
+
+	var count int64
+	if err := managers.DB.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Username already exists", http.StatusConflict)
+		return
+	}
+
+	if err := managers.DB.Create(&user).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	var roleIDs []string
+	for _, id := range r.Form["roleIds[]"] {
+		if id != "" {
+			roleIDs = append(roleIDs, id)
+		}
+	}
+
+	if len(roleIDs) > 0 {
+		var roles []models.Role
+		if err := managers.DB.Find(&roles, roleIDs).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+		if err := managers.DB.Model(&user).Association("Role").Replace(&roles); err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// 邮箱在用户确认后才写入
+	if email != "" {
+		if err := models.SendEmailVerification(r.Context(), &user, email); err != nil {
+			slog.Error("Failed to send verification email", "err", err)
+		}
+	}
+
+	slog.Info("User created by admin", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.SucessWithData(w, user)
+}
+
+// 修改用户资料，管理员修改的邮箱视为未验证
+func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r, r.PostFormValue("userId"))
+	if !ok {
+		return
+	}
+
+	updateData := make(map[string]interface{})
+	if username := r.PostFormValue("username"); username != "" && username != user.Username {
+		// 软删除的账号仍占用用户名，与创建用户时一样检查
+		var count int64
+		if err := managers.DB.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "Username already exists", http.StatusConflict)
+			return
+		}
+		updateData["username"] = username
+	}
+	if name := r.PostFormValue("name"); name != "" {
+		updateData["name"] = name
+	}
+	if phoneNumber := r.PostFormValue("phoneNumber"); phoneNumber != "" {
+		phone, err := models.NormalizePhone(phoneNumber)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if phone != user.PhoneNumber {
+			updateData["phone_number"] = phone
+			updateData["phone_verified"] = false
+		}
+	}
+	if email := r.PostFormValue("email"); email != "" {
+		email, err := models.NormalizeEmail(email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if email != user.Email {
+			updateData["email"] = email
+			updateData["email_verified"] = false
+		}
+	}
+	// 部门可以清空，传了参数就更新
+	departmentChanged := false
+	if _, ok := r.PostForm["department"]; ok {
+		updateData["department"] = r.PostFormValue("department")
+		departmentChanged = r.PostFormValue("department") != user.Department
+	}
+
+	if len(updateData) == 0 {
+		http.Error(w, "No data to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := managers.DB.Model(user).Updates(updateData).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	// 部门是策略条件中的主体属性，随有效权限一起缓存
+	if departmentChanged {
+		if err := models.InvalidatePermissions(r.Context(), managers.IDToString(user.ID)); err != nil {
+			slog.Error("Failed to invalidate permission cache", "id", user.ID, "err", err)
+		}
+	}
+
+	utils.SucessWithData(w, user)
+}
+
+// 停用用户，需要填写原因
+func handleSuspendUser(w http.ResponseWriter, r *http.Request) {
+	reason := r.PostFormValue("reason")
+	if reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := adminTargetUser(w, r, r.PostFormValue("userId"))
+	if !ok {
+		return
+	}
+
+	if managers.IDToString(user.ID) == r.Context().Value(UserID).(string) {
+		http.Error(w, "Cannot suspend yourself", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SuspendUser(r.Context(), user, reason); err != nil {
+		slog.Error("Failed to suspend user", "id", user.ID, "err", err)
+		http.Error(w, "Failed to suspend user", http.StatusInternalServerError)
+		return
+	}
+
+	event := models.UserEvent(managers.IDToString(user.ID), models.EventSessionRevoke, models.OutcomeSuccess)
+	event.Detail = "suspended by admin " + r.Context().Value(UserID).(string)
+	models.RecordLoginEvent(r, event)
+
+	slog.Warn("User suspended", "id", user.ID, "reason", reason, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// 恢复被停用的用户
+func handleUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r, r.PostFormValue("userId"))
+	if !ok {
+		return
+	}
+
+	if err := models.UnsuspendUser(r.Context(), user); err != nil {
+		slog.Error("Failed to unsuspend user", "id", user.ID, "err", err)
+		http.Error(w, "Failed to unsuspend user", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("User unsuspended", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// 要求用户下次登录时修改密码
+func handleForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r, r.PostFormValue("userId"))
+	if !ok {
+		return
+	}
+
+	if err := models.ForcePasswordChange(r.Context(), user); err != nil {
+		slog.Error("Failed to force password reset", "id", user.ID, "err", err)
+		http.Error(w, "Failed to force password reset", http.StatusInternalServerError)
+		return
+	}
+
+	event := models.UserEvent(managers.IDToString(user.ID), models.EventSessionRevoke, models.OutcomeSuccess)
+	event.Detail = "password reset forced by admin " + r.Context().Value(UserID).(string)
+	models.RecordLoginEvent(r, event)
+
+	slog.Info("Password reset forced", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// 软删除用户
+func handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	if managers.IDToString(user.ID) == r.Context().Value(UserID).(string) {
+		http.Error(w, "Cannot delete yourself", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SoftDeleteUser(r.Context(), user); err != nil {
+		slog.Error("Failed to delete user", "id", user.ID, "err", err)
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Warn("User deleted", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.Sucess(w)
+}
+
+// 恢复软删除的用户
+func handleRestoreUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PostFormValue("userId")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := models.RestoreUser(r.Context(), userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Deleted user not found", http.StatusNotFound)
+		} else {
+			slog.Error("Failed to restore user", "id", userID, "err", err)
+			http.Error(w, "Failed to restore user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	slog.Info("User restored", "id", user.ID, "by", r.Context().Value(UserID))
+	utils.SucessWithData(w, user)
+}
@@ -0,0 +1,65 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+)
+
+func challenges() {
+	http.Handle(accountParty+"/challenge", utils.CORS(http.HandlerFunc(handleGetChallenge), http.MethodGet))
+}
+
+// 获取工作量证明题目，action 为 login 或 register
+func handleGetChallenge(w http.ResponseWriter, r *http.Request) {
+	action := r.URL.Query().Get("action")
+	if action != models.ChallengeLogin && action != models.ChallengeRegister {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	if !managers.Config.Challenge.Enabled {
+		utils.SucessWithData(w, map[string]bool{"required": false})
+		return
+	}
+
+	challenge, err := models.NewChallenge(r.Context(), action, utils.ParseIP(r))
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, challenge)
+}
+
+// passChallenge 开启后要求表单带上 challenge 和 solution，未通过时已写回响应
+func passChallenge(w http.ResponseWriter, r *http.Request, action string) bool {
+	if !managers.Config.Challenge.Enabled {
+		return true
+	}
+
+	ctx := r.Context()
+	ip := utils.ParseIP(r)
+
+	err := models.VerifyChallenge(ctx, action, ip, r.PostFormValue("challenge"), r.PostFormValue("solution"))
+	if err == nil {
+		return true
+	}
+
+	if err != models.ErrChallengeFailed {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return false
+	}
+
+	if err := models.RecordChallengeFailure(ctx, ip); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+	}
+
+	slog.Warn(err.Error(), "action", action, "ip", ip)
+	http.Error(w, err.Error(), http.StatusPreconditionRequired)
+	return false
+}
@@ -0,0 +1,311 @@
+package routers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcParty = accountParty + "/oidc"
+	// oidcStateCookie 发起登录的浏览器持有 state，回调时必须一致，防止登录 CSRF
+	oidcStateCookie = "oidc_state"
+)
+
+func federation() {
+	models.FederationInit()
+	managers.InitOIDC()
+
+	http.Handle(oidcParty+"/providers", utils.CORS(http.HandlerFunc(handleListOIDCProviders), http.MethodGet))
+	http.Handle(oidcParty+"/login", utils.CORS(http.HandlerFunc(handleOIDCLogin), http.MethodGet))
+	http.Handle(oidcParty+"/link", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleOIDCLink))), http.MethodPost))
+	http.Handle(oidcParty+"/callback", http.HandlerFunc(handleOIDCCallback))
+	http.Handle(oidcParty+"/complete", utils.CORS(http.HandlerFunc(handleOIDCComplete), http.MethodPost))
+
+	http.Handle(oidcParty+"/identities", utils.CORS(verify(http.HandlerFunc(handleListIdentities)), http.MethodGet))
+	http.Handle(oidcParty+"/identity", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleUnlinkIdentity))), http.MethodDelete))
+}
+
+// federationRedirect 回调结束后跳回前端
+func federationRedirect(w http.ResponseWriter, r *http.Request, path string, params url.Values) {
+	target := strings.TrimSuffix(managers.Config.WebURL, "/") + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// 获取可用的外部身份提供方
+func handleListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(managers.OIDCProviders))
+	for name := range managers.OIDCProviders {
+		names = append(names, name)
+	}
+
+	utils.SucessWithData(w, names)
+}
+
+func beginOIDC(w http.ResponseWriter, r *http.Request, name string, linkUser string) {
+	provider, ok := managers.OIDCProviders[name]
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusBadRequest)
+		return
+	}
+
+	state, data, challenge, err := models.NewOIDCState(r.Context(), name, linkUser)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	authorizationURL, err := provider.AuthorizationURL(r.Context(), state, data.Nonce, challenge)
+	if err != nil {
+		msg := "Identity provider is unavailable"
+		slog.Error(msg, "provider", name, "err", err)
+		http.Error(w, msg, http.StatusBadGateway)
+		return
+	}
+
+	// 回调是从身份提供方跳转回来的跨站请求，Strict 的 cookie 不会带上，这里用 Lax
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcParty + "/callback",
+		MaxAge:   int(models.OIDCStateLife.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	utils.SucessWithData(w, map[string]string{"authorizationUrl": authorizationURL})
+}
+
+// 通过外部身份提供方登录，返回跳转地址
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	beginOIDC(w, r, r.URL.Query().Get("provider"), "")
+}
+
+// 为当前用户绑定外部身份，返回跳转地址
+func handleOIDCLink(w http.ResponseWriter, r *http.Request) {
+	beginOIDC(w, r, r.PostFormValue("provider"), r.Context().Value(UserID).(string))
+}
+
+// 身份提供方回调
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcParty + "/callback", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+
+	// state 必须与发起登录的浏览器持有的一致
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		slog.Error("OIDC state does not match the browser", "ip", utils.ParseIP(r))
+		federationRedirect(w, r, "/login", url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	state, err := models.TakeOIDCState(ctx, query.Get("state"))
+	if err != nil {
+		slog.Error("Invalid oidc state", "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	if query.Get("error") != "" {
+		federationRedirect(w, r, "/login", url.Values{"error": {query.Get("error")}})
+		return
+	}
+
+	provider, ok := managers.OIDCProviders[state.Provider]
+	if !ok {
+		federationRedirect(w, r, "/login", url.Values{"error": {"unknown_provider"}})
+		return
+	}
+
+	claims, err := provider.Exchange(ctx, query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		slog.Error("Failed to verify identity", "provider", state.Provider, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"verification_failed"}})
+		return
+	}
+
+	// 绑定流程
+	if state.LinkUser != "" {
+		id, _ := managers.StringToID(state.LinkUser)
+		if _, err := models.LinkIdentity(id, state.Provider, claims); err != nil {
+			slog.Error("Failed to link identity", "provider", state.Provider, "err", err)
+			code := "link_failed"
+			if err == models.ErrIdentityLinked {
+				code = "already_linked"
+			}
+			federationRedirect(w, r, "/settings/security", url.Values{"error": {code}})
+			return
+		}
+
+		federationRedirect(w, r, "/settings/security", url.Values{"linked": {state.Provider}})
+		return
+	}
+
+	user, err := models.FederatedUser(state.Provider, claims)
+	switch err {
+	case nil:
+	case models.ErrIdentityEmail:
+		federationRedirect(w, r, "/login", url.Values{"error": {"account_exists"}})
+		return
+	case models.ErrRegistrationClosed, models.ErrEmailDomain:
+		slog.Warn("Federated sign-up rejected", "provider", state.Provider, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"registration_closed"}})
+		return
+	default:
+		slog.Error(utils.DBErrorString, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"server_error"}})
+		return
+	}
+
+	code, err := models.NewOIDCLogin(ctx, managers.IDToString(user.ID), state.Provider)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"server_error"}})
+		return
+	}
+
+	// 凭据放在片段中，不会出现在服务端日志和 Referer 里，前端再通过 POST 换取登录结果
+	target := strings.TrimSuffix(managers.Config.WebURL, "/") + "/login/oidc#" + url.Values{"code": {code}}.Encode()
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// 用回调签发的一次性凭据完成登录，之后与密码登录相同
+func handleOIDCComplete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	code := r.PostFormValue("code")
+	if code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, provider, err := models.TakeOIDCLogin(ctx, code)
+	if err != nil {
+		if err == redis.Nil {
+			http.Error(w, "Code is invalid or has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.Suspended() {
+		event := models.UserEvent(userID, models.EventLogin, models.OutcomeBlocked)
+		event.Username, event.Method, event.Detail = user.Username, models.LoginMethodOIDC, provider+": suspended"
+		models.RecordLoginEvent(r, event)
+
+		http.Error(w, models.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 本地开启了两步验证时仍需第二步
+	if user.TOTPEnabled {
+		if loginThrottled(w, r, &models.LoginEvent{UserID: user.ID, Username: user.Username, Method: models.LoginMethodOIDC, Detail: provider}) {
+			return
+		}
+
+		pendingToken, err := models.NewPendingLogin(ctx, userID)
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		event := models.UserEvent(userID, models.EventTwoFactor, models.OutcomeIssued)
+		event.Username, event.Method, event.Detail = user.Username, models.LoginMethodOIDC, provider
+		models.RecordLoginEvent(r, event)
+
+		utils.SucessWithData(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
+		return
+	}
+
+	finishLogin(w, r, &user, utils.ParseIP(r), models.LoginMethodOIDC)
+}
+
+// 获取当前用户绑定的外部身份
+func handleListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+
+	var identities []models.ExternalIdentity
+	if err := managers.DB.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, identities)
+}
+
+// 解绑外部身份。没有密码的账号至少保留一个外部身份
+func handleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+	id := r.URL.Query().Get("id")
+
+	if id == "" {
+		http.Error(w, "Identity ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Select("id", "password").First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	var count int64
+	if err := managers.DB.Model(&models.ExternalIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if len(user.Password) == 0 && count <= 1 {
+		http.Error(w, "Set a password before unlinking your last external account", http.StatusConflict)
+		return
+	}
+
+	result := managers.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ExternalIdentity{})
+	if result.Error != nil {
+		slog.Error(utils.DBErrorString, "err", result.Error)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		http.Error(w, "Identity not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
@@ -0,0 +1,156 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const impersonationListLimit = 200
+
+func impersonation() {
+	models.ImpersonationInit()
+
+	http.Handle(adminParty+"/impersonate", utils.CORS(verify(RequirePermission("impersonate_users")(http.HandlerFunc(handleStartImpersonation))), http.MethodPost))
+	http.Handle(adminParty+"/impersonate/end", utils.CORS(verify(http.HandlerFunc(handleEndImpersonation)), http.MethodPost))
+	http.Handle(adminParty+"/impersonations", utils.CORS(verifyScoped(RequirePermission("impersonate_users")(http.HandlerFunc(handleListImpersonations))), http.MethodGet))
+}
+
+// 以指定用户身份登录，必须填写原因
+func handleStartImpersonation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	adminID := ctx.Value(UserID).(string)
+	userID := r.PostFormValue("userId")
+	reason := r.PostFormValue("reason")
+
+	if userID == "" || reason == "" {
+		http.Error(w, "User ID and reason are required", http.StatusBadRequest)
+		return
+	}
+
+	// 只能从普通的登录会话发起，结束后才能回到原会话
+	parentToken := ctx.Value(SessionToken).(string)
+	if parentToken == "" {
+		http.Error(w, "Forbidden: impersonation requires a browser session", http.StatusForbidden)
+		return
+	}
+
+	if userID == adminID {
+		http.Error(w, "Cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	var admin, target models.User
+	if err := managers.DB.First(&admin, adminID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := managers.DB.First(&target, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	adminPerms, ok := effectivePermissions(w, r)
+	if !ok {
+		return
+	}
+
+	targetPerms, err := models.GetEffectivePermissions(ctx, userID)
+	if err != nil {
+		slog.Error("Failed to load permissions", "err", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// 不能借此获得其他管理员的身份，也不能获得自己没有的角色和权限
+	if targetPerms.HasPermission("impersonate_users") {
+		http.Error(w, "Forbidden: cannot impersonate another administrator", http.StatusForbidden)
+		return
+	}
+	for _, role := range targetPerms.Roles {
+		if !adminPerms.HasRole(role) {
+			http.Error(w, "Forbidden: target has roles you do not hold", http.StatusForbidden)
+			return
+		}
+	}
+	for _, perm := range targetPerms.Permissions {
+		if !strings.HasPrefix(perm, models.PermissionDenyPrefix) && !adminPerms.HasPermission(perm) {
+			http.Error(w, "Forbidden: target has permissions you do not hold", http.StatusForbidden)
+			return
+		}
+	}
+
+	if _, err := models.StartImpersonation(w, r, &admin, &target, parentToken, reason); err != nil {
+		msg := "Failed to start impersonation"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	slog.Warn("Impersonation started", "admin", adminID, "user", userID, "reason", reason, "ip", utils.ParseIP(r))
+	utils.SucessWithData(w, map[string]interface{}{
+		"user":      target,
+		"expiresIn": int(models.ImpersonationLife.Seconds()),
+	})
+}
+
+// 结束模拟登录，回到管理员自己的会话
+func handleEndImpersonation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	adminID, ok := ctx.Value(ImpersonatorID).(string)
+	if !ok {
+		http.Error(w, "Not impersonating", http.StatusBadRequest)
+		return
+	}
+
+	userID := ctx.Value(UserID).(string)
+	parent, err := models.EndImpersonation(w, r, userID, ctx.Value(SessionToken).(string))
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	slog.Warn("Impersonation ended", "admin", adminID, "user", userID)
+
+	// 原会话已过期时需要重新登录
+	if parent == "" {
+		models.SetCookie(w, r, &http.Cookie{Name: "auth_status", Value: "0", Path: "/", MaxAge: -1})
+		utils.SucessWithData(w, map[string]bool{"reauthenticate": true})
+		return
+	}
+
+	var admin models.User
+	if err := managers.DB.First(&admin, adminID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{"user": admin})
+}
+
+// 获取模拟登录审计记录
+func handleListImpersonations(w http.ResponseWriter, r *http.Request) {
+	logs, err := models.ListImpersonations(impersonationListLimit)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, logs)
+}
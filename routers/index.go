@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"net/http"
 	"server-go/managers"
+	"server-go/models"
 	"server-go/utils"
 	"strings"
 
@@ -16,14 +17,45 @@ type RequestKey int
 const (
 	UserID RequestKey = iota + 1
 	RequestParam
+	SessionToken
+	TokenScopes
+	ImpersonatorID
+	OrganizationID
 )
 
 func Init() {
 	account()
 	admin()
+	twoFactor()
+	webauthn()
+	sessions()
+	tokens()
+	oauth()
+	federation()
+	personalTokens()
+	privacy()
+	invites()
+	challenges()
+	impersonation()
+	securityEvents()
+	magicLinks()
+	phone()
+	policies()
+	organizations()
 }
 
+// verify 登录检查中间件，只接受会话和 JWT，个人访问令牌一律拒绝
 func verify(next http.Handler) http.Handler {
+	return authenticate(next, false)
+}
+
+// verifyScoped 同 verify，另外接受个人访问令牌。
+// 只能用于由 RequirePermission、RequirePolicy、RequireOrgPermission 按 scope 把关的路由
+func verifyScoped(next http.Handler) http.Handler {
+	return authenticate(next, true)
+}
+
+func authenticate(next http.Handler, allowPersonalToken bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var token string
 		var msg string
@@ -50,7 +82,73 @@ func verify(next http.Handler) http.Handler {
 			}
 		}
 
-		id, err := managers.Redis.HGet(r.Context(), managers.TOKEN+token, "id").Result()
+		// 个人访问令牌只能放在 Authorization 头中
+		if strings.HasPrefix(token, models.PersonalTokenPrefix) {
+			if tokenHeader == "" {
+				msg = "Invalid Token"
+				slog.Error(msg)
+				http.Error(w, msg, http.StatusUnauthorized)
+				return
+			}
+
+			if !allowPersonalToken {
+				http.Error(w, "Forbidden: personal access tokens are not accepted by this endpoint", http.StatusForbidden)
+				return
+			}
+
+			id, scopes, err := models.VerifyPersonalToken(token, utils.ParseIP(r))
+			if err != nil {
+				if err == models.ErrPersonalTokenInvalid {
+					msg = "Invalid Token"
+					slog.Error(msg, "err", err)
+					http.Error(w, msg, http.StatusUnauthorized)
+				} else {
+					slog.Error(utils.DBErrorString, "err", err)
+					http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+				}
+				return
+			}
+
+			if rejectDisabled(w, r, id) {
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserID, id)
+			ctx = context.WithValue(ctx, SessionToken, "")
+			ctx = context.WithValue(ctx, TokenScopes, scopes)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// JWT 访问令牌离线校验，不访问 Redis
+		if managers.Config.JWT.Enabled && strings.Count(token, ".") == 2 {
+			id, org, err := models.VerifyAccessToken(token)
+			if err != nil {
+				msg = "Invalid Token"
+				slog.Error(msg, "err", err)
+				http.Error(w, msg, http.StatusUnauthorized)
+				return
+			}
+
+			if rejectDisabled(w, r, id) {
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserID, id)
+			ctx = context.WithValue(ctx, SessionToken, "")
+			if org != "" {
+				ctx = context.WithValue(ctx, OrganizationID, org)
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		fields, err := managers.Redis.HMGet(r.Context(), managers.TOKEN+token, "id", "imp", "org", "seen").Result()
+		if err == nil && fields[0] == nil {
+			err = redis.Nil
+		}
 		if err != nil {
 			if err == redis.Nil {
 				// 没有找到对应的Token
@@ -66,6 +164,52 @@ func verify(next http.Handler) http.Handler {
 			return
 		}
 
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserID, id)))
+		seen, _ := fields[3].(string)
+		if err := models.TouchSession(r.Context(), token, seen); err != nil {
+			slog.Error("Failed to touch session", "err", err)
+		}
+
+		id, _ := fields[0].(string)
+		if rejectDisabled(w, r, id) {
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), UserID, id)
+		ctx = context.WithValue(ctx, SessionToken, token)
+		if org, _ := fields[2].(string); org != "" {
+			ctx = context.WithValue(ctx, OrganizationID, org)
+		}
+
+		// 模拟登录的会话同时带上管理员 ID，每个请求都记录审计日志
+		if impersonator, _ := fields[1].(string); impersonator != "" {
+			if impersonationDenied(r.URL.Path) {
+				http.Error(w, "Forbidden: not allowed while impersonating", http.StatusForbidden)
+				return
+			}
+
+			ctx = context.WithValue(ctx, ImpersonatorID, impersonator)
+			slog.Info("Impersonated request", "admin", impersonator, "user", id, "method", r.Method, "path", r.URL.Path)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// rejectDisabled 停用或删除的账号一律拒绝，包括尚未过期的 JWT 和个人访问令牌。停用标记缓存在进程内，不访问 Redis
+func rejectDisabled(w http.ResponseWriter, r *http.Request, id string) bool {
+	disabled, err := models.UserDisabled(r.Context(), id)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return true
+	}
+
+	if disabled {
+		msg := "Account is disabled"
+		slog.Warn(msg, "id", id)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	inviteDefaultUses = 1
+	inviteDefaultDays = 7
+)
+
+func invites() {
+	models.InviteInit()
+
+	http.Handle(adminParty+"/invites", utils.CORS(verifyScoped(RequirePermission("manage_users")(utils.Methods(
+		utils.Get(http.HandlerFunc(handleListInvites)),
+		utils.Post(http.HandlerFunc(handleCreateInvite)),
+	))), http.MethodGet, http.MethodPost))
+	http.Handle(adminParty+"/invite", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleRevokeInvite))), http.MethodDelete))
+}
+
+// 获取邀请码列表
+func handleListInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := models.ListInvites()
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, invites)
+}
+
+// 创建邀请码，填写邮箱时发送邀请邮件
+func handleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	maxUses := inviteDefaultUses
+	if value := r.PostFormValue("maxUses"); value != "" {
+		var err error
+		if maxUses, err = strconv.Atoi(value); err != nil || maxUses <= 0 {
+			http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+			return
+		}
+	}
+
+	days := inviteDefaultDays
+	if value := r.PostFormValue("expiresIn"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+			http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+			return
+		}
+	}
+
+	email := r.PostFormValue("email")
+	if email != "" {
+		var err error
+		if email, err = models.NormalizeEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var roleIDs []string
+	for _, id := range r.Form["roleIds[]"] {
+		if id != "" {
+			roleIDs = append(roleIDs, id)
+		}
+	}
+
+	roles, roleNames, permissions, err := models.RoleGrants(roleIDs)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	// 只能邀请进自己拥有的角色，角色（含继承）授予的权限也必须都在自己的权限之内
+	inviter, ok := effectivePermissions(w, r)
+	if !ok {
+		return
+	}
+	for _, name := range roleNames {
+		if !inviter.HasRole(name) {
+			http.Error(w, "Forbidden: cannot grant role "+name, http.StatusForbidden)
+			return
+		}
+	}
+	for _, name := range permissions {
+		if !inviter.HasPermission(name) {
+			http.Error(w, "Forbidden: cannot grant permission "+name, http.StatusForbidden)
+			return
+		}
+	}
+
+	createdBy, err := managers.StringToID(r.Context().Value(UserID).(string))
+	if err != nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	code, invite, err := models.NewInvite(createdBy, maxUses, time.Duration(days)*24*time.Hour, roles, email)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if email != "" {
+		if err := models.SendInvitation(r.Context(), invite, code); err != nil {
+			msg := "Failed to send invitation email"
+			slog.Error(msg, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"code":   code,
+		"invite": invite,
+	})
+}
+
+// 作废邀请码
+func handleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Invite ID is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := models.RevokeInvite(id)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
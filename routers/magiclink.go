@@ -0,0 +1,237 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	magicLinkIPLimit      = 10
+	magicLinkAccountLimit = 5
+)
+
+func magicLinks() {
+	if !managers.Config.MagicLink.Enabled {
+		return
+	}
+
+	http.Handle(accountParty+"/login/link", utils.CORS(http.HandlerFunc(handleRequestMagicLink), http.MethodPost))
+	http.Handle(models.MagicLinkPath, http.HandlerFunc(handleMagicLinkLogin))
+	http.Handle(accountParty+"/login/link/complete", utils.CORS(http.HandlerFunc(handleMagicLinkComplete), http.MethodPost))
+}
+
+// setMagicNonce 浏览器随机数需要在从邮件跳转时带上，因此使用 Lax 而不是 Strict
+func setMagicNonce(w http.ResponseWriter, value string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     models.MagicLinkCookie,
+		Value:    value,
+		Path:     models.MagicLinkPath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if managers.Config.Domain != "" {
+		cookie.Domain = managers.Config.Domain
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+// 申请免密登录链接。无论账号是否存在都返回成功并写入浏览器随机数
+func handleRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account := r.PostFormValue("account")
+
+	if account == "" {
+		http.Error(w, "Username or email is required", http.StatusBadRequest)
+		return
+	}
+
+	if !passChallenge(w, r, models.ChallengeLogin) {
+		return
+	}
+
+	ip := utils.ParseIP(r)
+	reply, err := utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.MAGICIPLIMIT+ip, time.Hour)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if reply > magicLinkIPLimit {
+		msg := "Too many sign-in link requests. Please try again later."
+		slog.Error(msg, "ip", ip)
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return
+	}
+
+	nonce := models.NewMagicLinkNonce()
+	setMagicNonce(w, nonce, int(models.MagicLinkLife().Seconds()))
+
+	var user models.User
+	if err := managers.DB.
+		Where("username = ?", account).
+		Or("email = ? AND email_verified = ?", account, true).
+		First(&user).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		slog.Warn("Sign-in link for unknown account", "account", account, "ip", ip)
+		utils.Sucess(w)
+		return
+	}
+
+	id := managers.IDToString(user.ID)
+	reply, err = utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.MAGICLIMIT+id, time.Hour)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if reply > magicLinkAccountLimit {
+		slog.Warn("Sign-in link limit reached", "id", id, "ip", ip)
+		utils.Sucess(w)
+		return
+	}
+
+	if user.Email == "" || !user.EmailVerified || user.Suspended() {
+		slog.Warn("Sign-in link for account that cannot receive one", "id", id)
+		utils.Sucess(w)
+		return
+	}
+
+	if err := models.SendMagicLink(ctx, &user, nonce); err != nil {
+		msg := "Failed to send sign-in link"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 打开邮件中的登录链接，校验通过后签发一次性凭据并跳回前端
+func handleMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var nonce string
+	if cookie, err := r.Cookie(models.MagicLinkCookie); err == nil {
+		nonce = cookie.Value
+	}
+
+	userID, err := models.TakeMagicLink(ctx, r.URL.Query().Get("token"), nonce)
+	if err == models.ErrMagicLinkBrowser {
+		event := models.UserEvent(userID, models.EventLogin, models.OutcomeFailure)
+		event.Method, event.Detail = models.LoginMethodMagicLink, "browser mismatch"
+		models.RecordLoginEvent(r, event)
+
+		federationRedirect(w, r, "/login", url.Values{"error": {"link_browser_mismatch"}})
+		return
+	}
+	if err == models.ErrLinkInvalid {
+		federationRedirect(w, r, "/login", url.Values{"error": {"link_invalid"}})
+		return
+	}
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"server_error"}})
+		return
+	}
+
+	setMagicNonce(w, "", -1)
+
+	code, err := models.NewMagicLogin(ctx, userID)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		federationRedirect(w, r, "/login", url.Values{"error": {"server_error"}})
+		return
+	}
+
+	// 凭据放在片段中，不会出现在服务端日志和 Referer 里，前端再通过 POST 换取登录结果
+	target := strings.TrimSuffix(managers.Config.WebURL, "/") + "/login/link#" + url.Values{"code": {code}}.Encode()
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// 用打开链接时签发的一次性凭据完成登录，之后与密码登录相同
+func handleMagicLinkComplete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	code := r.PostFormValue("code")
+	if code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := models.TakeMagicLogin(ctx, code)
+	if err != nil {
+		if err == redis.Nil {
+			http.Error(w, "Code is invalid or has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if user.Suspended() {
+		event := models.UserEvent(userID, models.EventLogin, models.OutcomeBlocked)
+		event.Username, event.Method, event.Detail = user.Username, models.LoginMethodMagicLink, "suspended"
+		models.RecordLoginEvent(r, event)
+
+		http.Error(w, models.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 邮件链接只代替密码，开启了两步验证时仍需第二步
+	if user.TOTPEnabled {
+		if loginThrottled(w, r, &models.LoginEvent{UserID: user.ID, Username: user.Username, Method: models.LoginMethodMagicLink}) {
+			return
+		}
+
+		pendingToken, err := models.NewPendingLogin(ctx, userID)
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		event := models.UserEvent(userID, models.EventTwoFactor, models.OutcomeIssued)
+		event.Username, event.Method = user.Username, models.LoginMethodMagicLink
+		models.RecordLoginEvent(r, event)
+
+		utils.SucessWithData(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
+		return
+	}
+
+	managers.Redis.Del(ctx, managers.MAGICLIMIT+userID)
+	finishLogin(w, r, &user, utils.ParseIP(r), models.LoginMethodMagicLink)
+}
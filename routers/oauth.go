@@ -0,0 +1,573 @@
+package routers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const oauthParty = "/oauth"
+
+func oauth() {
+	models.OAuthInit()
+
+	http.Handle("/.well-known/openid-configuration", utils.CORS(http.HandlerFunc(handleOpenIDConfiguration), http.MethodGet))
+
+	// 同意页面调用的接口，需要本站登录态
+	http.Handle(oauthParty+"/authorize", utils.CORS(verify(http.HandlerFunc(handleOAuthAuthorize)), http.MethodGet))
+	http.Handle(oauthParty+"/consent", utils.CORS(verify(http.HandlerFunc(handleOAuthConsent)), http.MethodPost))
+
+	// 客户端调用的接口
+	http.Handle(oauthParty+"/token", utils.CORS(http.HandlerFunc(handleOAuthToken), http.MethodPost))
+	http.Handle(oauthParty+"/userinfo", utils.CORS(http.HandlerFunc(handleOAuthUserInfo), http.MethodGet, http.MethodPost))
+
+	// 客户端管理
+	http.Handle(adminParty+"/oauth/clients", utils.CORS(verifyScoped(RequirePermission("manage_oauth_clients")(http.HandlerFunc(handleListOAuthClients))), http.MethodGet))
+	http.Handle(adminParty+"/oauth/client", utils.CORS(verifyScoped(RequirePermission("manage_oauth_clients")(http.HandlerFunc(handleCreateOAuthClient))), http.MethodPost))
+	http.Handle(adminParty+"/oauth/client/update", utils.CORS(verifyScoped(RequirePermission("manage_oauth_clients")(http.HandlerFunc(handleUpdateOAuthClient))), http.MethodPut))
+	http.Handle(adminParty+"/oauth/client/secret", utils.CORS(verifyScoped(RequirePermission("manage_oauth_clients")(http.HandlerFunc(handleResetOAuthClientSecret))), http.MethodPost))
+	http.Handle(adminParty+"/oauth/client/delete", utils.CORS(verifyScoped(RequirePermission("manage_oauth_clients")(http.HandlerFunc(handleDeleteOAuthClient))), http.MethodDelete))
+}
+
+// oauthError 按 RFC 6749 返回错误
+func oauthError(w http.ResponseWriter, status int, code string, description string) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func oauthJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(data)
+}
+
+// oauthRedirect 拼接回调地址
+func oauthRedirect(redirectURI string, params url.Values) string {
+	if strings.Contains(redirectURI, "?") {
+		return redirectURI + "&" + params.Encode()
+	}
+	return redirectURI + "?" + params.Encode()
+}
+
+// 发现文档
+func handleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	alg, _ := utils.JWTAlgorithm(managers.JWTKey)
+	issuer := managers.Config.ServerURL
+
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                strings.TrimSuffix(managers.Config.WebURL, "/") + oauthParty + "/authorize",
+		"token_endpoint":                        issuer + oauthParty + "/token",
+		"userinfo_endpoint":                     issuer + oauthParty + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"scopes_supported":                      models.OAuthScopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{alg},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"preferred_username", "name", "email", "email_verified", "phone_number", "phone_number_verified", "roles", "permissions",
+		},
+	})
+}
+
+// 授权请求。已同意过则直接签发授权码，否则返回同意页面需要的信息
+func handleOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	query := r.URL.Query()
+
+	var client models.OAuthClient
+	if err := managers.DB.Where("client_id = ?", query.Get("client_id")).First(&client).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Unknown client", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 回调地址不可信时不能重定向，直接报错
+	redirectURI := query.Get("redirect_uri")
+	if !client.AllowsRedirect(redirectURI) {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	state := query.Get("state")
+	fail := func(code string, description string) {
+		params := url.Values{"error": {code}, "error_description": {description}}
+		if state != "" {
+			params.Set("state", state)
+		}
+		utils.SucessWithData(w, map[string]string{"redirectUri": oauthRedirect(redirectURI, params)})
+	}
+
+	if query.Get("response_type") != "code" {
+		fail("unsupported_response_type", "only the code response type is supported")
+		return
+	}
+
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		fail("invalid_request", "PKCE with S256 is required")
+		return
+	}
+
+	scope := strings.Join(strings.Fields(query.Get("scope")), " ")
+	if scope == "" || !client.AllowsScope(scope) {
+		fail("invalid_scope", "requested scope is not allowed")
+		return
+	}
+
+	request := models.OAuthRequest{
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		State:         state,
+		Nonce:         query.Get("nonce"),
+		CodeChallenge: query.Get("code_challenge"),
+		AuthTime:      time.Now().Unix(),
+	}
+
+	consented, err := models.HasConsent(userID, client.ClientID, scope)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if consented && query.Get("prompt") != "consent" {
+		issueOAuthCode(w, r, &request)
+		return
+	}
+
+	if query.Get("prompt") == "none" {
+		fail("consent_required", "user consent is required")
+		return
+	}
+
+	requestID, err := models.SaveOAuthRequest(ctx, &request)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"consentRequired": true,
+		"requestId":       requestID,
+		"client":          map[string]string{"clientId": client.ClientID, "name": client.Name},
+		"scopes":          strings.Fields(scope),
+	})
+}
+
+// 用户在同意页面做出选择
+func handleOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	requestID := r.PostFormValue("requestId")
+	approve := r.PostFormValue("approve") == "true"
+
+	request, err := models.TakeOAuthRequest(ctx, requestID)
+	if err != nil {
+		if err == redis.Nil || err == models.ErrOAuthCodeInvalid {
+			http.Error(w, "Authorization request has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if request.UserID != userID {
+		http.Error(w, "Authorization request belongs to another user", http.StatusForbidden)
+		return
+	}
+
+	if !approve {
+		params := url.Values{"error": {"access_denied"}, "error_description": {"the user denied the request"}}
+		if request.State != "" {
+			params.Set("state", request.State)
+		}
+		utils.SucessWithData(w, map[string]string{"redirectUri": oauthRedirect(request.RedirectURI, params)})
+		return
+	}
+
+	if err := models.SaveConsent(userID, request.ClientID, request.Scope); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	issueOAuthCode(w, r, request)
+}
+
+func issueOAuthCode(w http.ResponseWriter, r *http.Request, request *models.OAuthRequest) {
+	code, err := models.NewOAuthCode(r.Context(), request)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+
+	utils.SucessWithData(w, map[string]string{"redirectUri": oauthRedirect(request.RedirectURI, params)})
+}
+
+// authenticateOAuthClient 支持 client_secret_basic、client_secret_post 和公开客户端
+func authenticateOAuthClient(r *http.Request) (*models.OAuthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, false
+	}
+
+	var client models.OAuthClient
+	if err := managers.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			slog.Error(utils.DBErrorString, "err", err)
+		}
+		return nil, false
+	}
+
+	if client.Public {
+		return &client, secret == ""
+	}
+
+	return &client, client.CheckSecret(secret)
+}
+
+// 令牌端点
+func handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := authenticateOAuthClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		handleOAuthAuthorizationCode(w, r, client)
+	case "client_credentials":
+		handleOAuthClientCredentials(w, r, client)
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant type is not supported")
+	}
+}
+
+func handleOAuthAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	request, err := models.TakeOAuthCode(r.Context(), r.PostFormValue("code"))
+	if err != nil {
+		if err != redis.Nil && err != models.ErrOAuthCodeInvalid {
+			slog.Error(utils.CacheErrorString, "err", err)
+		}
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or has expired")
+		return
+	}
+
+	if request.ClientID != client.ClientID || request.RedirectURI != r.PostFormValue("redirect_uri") {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client")
+		return
+	}
+
+	if !models.CheckPKCE(request.CodeChallenge, r.PostFormValue("code_verifier")) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match")
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Preload("Role.Permission").Preload("Permission").First(&user, request.UserID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "user no longer exists")
+		return
+	}
+
+	blocked, err := oauthUserBlocked(r.Context(), &user)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to check user status")
+		return
+	}
+	if blocked {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "user is suspended or disabled")
+		return
+	}
+
+	if err := user.LoadInheritedRoles(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to load roles")
+		return
+	}
+
+	access, err := models.NewOAuthAccessToken(request.UserID, client.ClientID, request.Scope, "authorization_code")
+	if err != nil {
+		slog.Error("Failed to sign access token", "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to sign access token")
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   managers.Config.JWT.AccessLife,
+		"scope":        request.Scope,
+	}
+
+	if slices.Contains(strings.Fields(request.Scope), "openid") {
+		idToken, err := models.NewIDToken(&user, request)
+		if err != nil {
+			slog.Error("Failed to sign id token", "err", err)
+			oauthError(w, http.StatusInternalServerError, "server_error", "failed to sign id token")
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	oauthJSON(w, response)
+}
+
+// oauthUserBlocked 用户同意授权后被暂停或停用时，不再签发令牌，也不再向下游应用返回用户信息
+func oauthUserBlocked(ctx context.Context, user *models.User) (bool, error) {
+	if user.Suspended() {
+		return true, nil
+	}
+	return models.UserDisabled(ctx, managers.IDToString(user.ID))
+}
+
+func handleOAuthClientCredentials(w http.ResponseWriter, r *http.Request, client *models.OAuthClient) {
+	if client.Public {
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "public clients cannot use client_credentials")
+		return
+	}
+
+	scope := strings.Join(strings.Fields(r.PostFormValue("scope")), " ")
+	if !client.AllowsScope(scope) || slices.Contains(strings.Fields(scope), "openid") {
+		oauthError(w, http.StatusBadRequest, "invalid_scope", "requested scope is not allowed")
+		return
+	}
+
+	access, err := models.NewOAuthAccessToken(client.ClientID, client.ClientID, scope, "client_credentials")
+	if err != nil {
+		slog.Error("Failed to sign access token", "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to sign access token")
+		return
+	}
+
+	oauthJSON(w, map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   managers.Config.JWT.AccessLife,
+		"scope":        scope,
+	})
+}
+
+// userinfo 端点
+func handleOAuthUserInfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	claims, err := models.VerifyOAuthAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "access token is invalid")
+		return
+	}
+
+	scope, _ := claims["scope"].(string)
+	if gty, _ := claims["gty"].(string); gty == "client_credentials" || !slices.Contains(strings.Fields(scope), "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		oauthError(w, http.StatusForbidden, "insufficient_scope", "openid scope is required")
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Preload("Role.Permission").Preload("Permission").First(&user, claims["sub"]).Error; err != nil {
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "user no longer exists")
+		return
+	}
+
+	blocked, err := oauthUserBlocked(r.Context(), &user)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to check user status")
+		return
+	}
+	if blocked {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "user is suspended or disabled")
+		return
+	}
+
+	if err := user.LoadInheritedRoles(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		oauthError(w, http.StatusInternalServerError, "server_error", "failed to load roles")
+		return
+	}
+
+	oauthJSON(w, models.OAuthClaims(&user, scope))
+}
+
+// 获取所有 OAuth 客户端
+func handleListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	var clients []models.OAuthClient
+	if err := managers.DB.Find(&clients).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, clients)
+}
+
+// 注册 OAuth 客户端，密钥只在创建时返回一次
+func handleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("name")
+	redirectURIs := strings.Fields(r.PostFormValue("redirectUris"))
+	scopes := strings.Fields(r.PostFormValue("scopes"))
+	public := r.PostFormValue("public") == "true"
+
+	if name == "" || len(redirectURIs) == 0 {
+		http.Error(w, "Client name and redirect URIs are required", http.StatusBadRequest)
+		return
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(models.OAuthScopes, scope) {
+			http.Error(w, "Unsupported scope: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	client := models.OAuthClient{
+		ClientID:     utils.RandomURLBase64(18),
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+		Public:       public,
+	}
+
+	var secret string
+	if !public {
+		secret = client.NewOAuthSecret()
+	}
+
+	if err := managers.DB.Create(&client).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{"client": client, "clientSecret": secret})
+}
+
+// 更新 OAuth 客户端
+func handleUpdateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	if id == "" {
+		http.Error(w, "Client ID is required", http.StatusBadRequest)
+		return
+	}
+
+	updateData := make(map[string]interface{})
+	if name := r.PostFormValue("name"); name != "" {
+		updateData["name"] = name
+	}
+	if redirectURIs := strings.Fields(r.PostFormValue("redirectUris")); len(redirectURIs) > 0 {
+		updateData["redirect_uris"] = strings.Join(redirectURIs, " ")
+	}
+	if r.PostForm.Has("scopes") {
+		scopes := strings.Fields(r.PostFormValue("scopes"))
+		for _, scope := range scopes {
+			if !slices.Contains(models.OAuthScopes, scope) {
+				http.Error(w, "Unsupported scope: "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+		updateData["scopes"] = strings.Join(scopes, " ")
+	}
+
+	if len(updateData) == 0 {
+		http.Error(w, "No data to update", http.StatusBadRequest)
+		return
+	}
+
+	if err := managers.DB.Model(&models.OAuthClient{}).Where("id = ?", id).Updates(updateData).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 重新生成客户端密钥
+func handleResetOAuthClientSecret(w http.ResponseWriter, r *http.Request) {
+	var client models.OAuthClient
+	if err := managers.DB.First(&client, r.PostFormValue("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Client not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if client.Public {
+		http.Error(w, "Public clients have no secret", http.StatusBadRequest)
+		return
+	}
+
+	secret := client.NewOAuthSecret()
+	if err := managers.DB.Model(&client).Update("secret_hash", client.SecretHash).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]string{"clientSecret": secret})
+}
+
+// 删除 OAuth 客户端
+func handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Client ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := managers.DB.Delete(&models.OAuthClient{}, id).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
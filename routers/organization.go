@@ -0,0 +1,583 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const orgParty = "/org"
+
+func organizations() {
+	models.OrganizationInit()
+
+	// 当前用户的组织
+	http.Handle(accountParty+"/organizations", utils.CORS(verify(http.HandlerFunc(handleListMyOrganizations)), http.MethodGet))
+	http.Handle(accountParty+"/organization/select", utils.CORS(verify(http.HandlerFunc(handleSelectOrganization)), http.MethodPost))
+	http.Handle(accountParty+"/organization/invitations", utils.CORS(verify(http.HandlerFunc(handleListMyInvitations)), http.MethodGet))
+	http.Handle(accountParty+"/organization/invitation/accept", utils.CORS(verify(http.HandlerFunc(handleAcceptInvitation)), http.MethodPost))
+	http.Handle(accountParty+"/organization/invitation/decline", utils.CORS(verify(http.HandlerFunc(handleDeclineInvitation)), http.MethodPost))
+
+	// 全局管理
+	http.Handle(adminParty+"/organizations", utils.CORS(verifyScoped(RequirePermission("manage_organizations")(http.HandlerFunc(handleListOrganizations))), http.MethodGet))
+	http.Handle(adminParty+"/organization", utils.CORS(verifyScoped(RequirePermission("manage_organizations")(http.HandlerFunc(handleCreateOrganization))), http.MethodPost))
+	http.Handle(adminParty+"/organization/delete", utils.CORS(verifyScoped(RequirePermission("manage_organizations")(http.HandlerFunc(handleDeleteOrganization))), http.MethodDelete))
+
+	// 组织内管理，作用于会话当前所选的组织
+	http.Handle(orgParty+"/members", utils.CORS(verifyScoped(RequireOrgPermission("org:members:read")(http.HandlerFunc(handleListMembers))), http.MethodGet))
+	http.Handle(orgParty+"/invitations", utils.CORS(verifyScoped(RequireOrgPermission("org:members:manage")(http.HandlerFunc(handleListInvitations))), http.MethodGet))
+	http.Handle(orgParty+"/invitation", utils.CORS(verifyScoped(RequireOrgPermission("org:members:manage")(http.HandlerFunc(handleInviteMember))), http.MethodPost))
+	http.Handle(orgParty+"/invitation/delete", utils.CORS(verifyScoped(RequireOrgPermission("org:members:manage")(http.HandlerFunc(handleRevokeInvitation))), http.MethodDelete))
+	http.Handle(orgParty+"/member/roles", utils.CORS(verifyScoped(RequireOrgPermission("org:members:manage")(http.HandlerFunc(handleAssignMemberRoles))), http.MethodPost))
+	http.Handle(orgParty+"/member/delete", utils.CORS(verifyScoped(RequireOrgPermission("org:members:manage")(http.HandlerFunc(handleRemoveMember))), http.MethodDelete))
+	http.Handle(orgParty+"/roles", utils.CORS(verifyScoped(RequireOrgPermission("org:members:read")(http.HandlerFunc(handleListOrgRoles))), http.MethodGet))
+	http.Handle(orgParty+"/role", utils.CORS(verifyScoped(RequireOrgPermission("org:roles:manage")(http.HandlerFunc(handleCreateOrgRole))), http.MethodPost))
+	http.Handle(orgParty+"/role/update", utils.CORS(verifyScoped(RequireOrgPermission("org:roles:manage")(http.HandlerFunc(handleUpdateOrgRole))), http.MethodPut))
+	http.Handle(orgParty+"/role/delete", utils.CORS(verifyScoped(RequireOrgPermission("org:roles:manage")(http.HandlerFunc(handleDeleteOrgRole))), http.MethodDelete))
+}
+
+// orgRoles 按 ID 查找组织内的角色，其他组织的角色被隔离查不到，视为参数错误
+func orgRoles(w http.ResponseWriter, r *http.Request, ids []string) ([]models.OrganizationRole, bool) {
+	roles := []models.OrganizationRole{}
+	if len(ids) == 0 {
+		return roles, true
+	}
+
+	if err := managers.DB.WithContext(r.Context()).Where("id IN ?", ids).Find(&roles).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if len(roles) != len(ids) {
+		http.Error(w, "Role not found", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return roles, true
+}
+
+// orgMember 查找组织内的成员，失败时已写回响应
+func orgMember(w http.ResponseWriter, r *http.Request, userID string) (*models.OrganizationMember, bool) {
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	member, err := models.FindOrganizationMember(managers.DB.WithContext(r.Context()), userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Member not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return member, true
+}
+
+// 列出当前用户加入的组织
+func handleListMyOrganizations(w http.ResponseWriter, r *http.Request) {
+	members, err := models.UserOrganizations(r.Context().Value(UserID).(string))
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	selected, _ := r.Context().Value(OrganizationID).(string)
+	utils.SucessWithData(w, map[string]interface{}{
+		"selected":      selected,
+		"organizations": members,
+	})
+}
+
+// 选择当前组织，organizationId 为空时取消选择，记录在会话中。
+// JWT 模式下不能凭访问令牌换发新令牌，否则被盗的访问令牌可以无限续期，
+// 客户端应在刷新令牌时带上 organizationId
+func handleSelectOrganization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+
+	token, _ := ctx.Value(SessionToken).(string)
+	if token == "" {
+		http.Error(w, "Use "+accountParty+"/token/refresh with organizationId to select an organization", http.StatusBadRequest)
+		return
+	}
+
+	organizationID := ""
+	if value := r.PostFormValue("organizationId"); value != "" && value != "0" {
+		id, err := managers.StringToID(value)
+		if err != nil {
+			http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+			return
+		}
+
+		ok, err := models.CanAccessOrganization(ctx, userID, id)
+		if err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+		// 不区分组织不存在和不是成员，避免探测其他组织
+		if !ok {
+			http.Error(w, "Organization not found", http.StatusNotFound)
+			return
+		}
+		organizationID = managers.IDToString(id)
+	}
+
+	if err := models.SelectSessionOrganization(ctx, token, organizationID); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]string{"organizationId": organizationID})
+}
+
+// 列出当前用户收到的组织邀请
+func handleListMyInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := models.UserOrganizationInvitations(r.Context().Value(UserID).(string))
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, invitations)
+}
+
+// 接受组织邀请
+func handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	if id == "" {
+		http.Error(w, "Invitation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	member, err := models.AcceptOrganizationInvitation(r.Context(), r.Context().Value(UserID).(string), id)
+	if err != nil {
+		switch err {
+		case gorm.ErrRecordNotFound:
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+		case models.ErrOrganizationMember:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.SucessWithData(w, member)
+}
+
+// 拒绝组织邀请
+func handleDeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	id := r.PostFormValue("id")
+	if id == "" {
+		http.Error(w, "Invitation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := models.DeclineOrganizationInvitation(r.Context().Value(UserID).(string), id)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 获取所有组织
+func handleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	var orgs []models.Organization
+	if err := managers.DB.Order("id").Find(&orgs).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, orgs)
+}
+
+// 创建组织，传 ownerId 时该用户成为组织管理员
+func handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	org := models.Organization{
+		Name:        r.PostFormValue("name"),
+		Slug:        r.PostFormValue("slug"),
+		Description: r.PostFormValue("description"),
+	}
+
+	if org.Name == "" {
+		http.Error(w, "Organization name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.ValidateOrganizationSlug(org.Slug); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ownerID uint
+	if value := r.PostFormValue("ownerId"); value != "" {
+		owner, ok := adminTargetUser(w, r, value)
+		if !ok {
+			return
+		}
+		ownerID = owner.ID
+	}
+
+	var count int64
+	if err := managers.DB.Unscoped().Model(&models.Organization{}).Where("slug = ?", org.Slug).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Slug already exists", http.StatusConflict)
+		return
+	}
+
+	if err := models.CreateOrganization(r.Context(), &org, ownerID); err != nil {
+		msg := "Failed to create organization"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, org)
+}
+
+// 删除组织，成员和角色一并删除
+func handleDeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	organizationID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Organization ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.DeleteOrganization(r.Context(), organizationID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Organization not found", http.StatusNotFound)
+		} else {
+			msg := "Failed to delete organization"
+			slog.Error(msg, "id", organizationID, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 列出组织成员
+func handleListMembers(w http.ResponseWriter, r *http.Request) {
+	var members []models.OrganizationMember
+	if err := managers.DB.WithContext(r.Context()).
+		Preload("User", func(tx *gorm.DB) *gorm.DB {
+			return tx.Select("id", "username", "name", "email")
+		}).
+		Preload("Role").
+		Order("id").
+		Find(&members).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, members)
+}
+
+// 列出组织发出的未过期邀请
+func handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	var invitations []models.OrganizationInvitation
+	if err := managers.DB.WithContext(r.Context()).
+		Preload("User", func(tx *gorm.DB) *gorm.DB {
+			return tx.Select("id", "username")
+		}).
+		Preload("Role").
+		Where("expires_at > ?", time.Now()).
+		Order("id").
+		Find(&invitations).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, invitations)
+}
+
+// 按用户名邀请用户加入组织，用户接受后才成为成员，不传角色时分配默认的 member 角色。
+// 用户不存在时同样返回成功，不能借此探测账号
+func handleInviteMember(w http.ResponseWriter, r *http.Request) {
+	username := r.PostFormValue("username")
+	if username == "" {
+		http.Error(w, "Username is required", http.StatusBadRequest)
+		return
+	}
+
+	roleIDs := r.Form["roleIds[]"]
+	roles, ok := orgRoles(w, r, roleIDs)
+	if !ok {
+		return
+	}
+
+	tx := managers.DB.WithContext(r.Context())
+	if len(roleIDs) == 0 {
+		if err := tx.Where("name = ?", models.OrganizationMemberRole).Find(&roles).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	invitedBy, err := managers.StringToID(r.Context().Value(UserID).(string))
+	if err != nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Select("id").Where("username = ?", username).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.Sucess(w)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, err := models.InviteOrganizationMember(tx, user.ID, invitedBy, roles); err != nil {
+		if err == models.ErrOrganizationMember {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 撤回邀请
+func handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	invitationID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invitation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tx := managers.DB.WithContext(r.Context())
+
+	var invitation models.OrganizationInvitation
+	if err := tx.First(&invitation, invitationID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Invitation not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := tx.Select("Role").Delete(&invitation).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 设置成员在组织内的角色
+func handleAssignMemberRoles(w http.ResponseWriter, r *http.Request) {
+	member, ok := orgMember(w, r, r.PostFormValue("userId"))
+	if !ok {
+		return
+	}
+
+	roles, ok := orgRoles(w, r, r.Form["roleIds[]"])
+	if !ok {
+		return
+	}
+
+	if err := managers.DB.WithContext(r.Context()).Model(member).Association("Role").Replace(roles); err != nil {
+		msg := "Failed to assign roles"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 把成员移出组织，不能移除自己
+func handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("userId")
+	if userID == r.Context().Value(UserID).(string) {
+		http.Error(w, "Cannot remove yourself", http.StatusBadRequest)
+		return
+	}
+
+	member, ok := orgMember(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := managers.DB.WithContext(r.Context()).Select("Role").Delete(member).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 列出组织内的角色
+func handleListOrgRoles(w http.ResponseWriter, r *http.Request) {
+	var roles []models.OrganizationRole
+	if err := managers.DB.WithContext(r.Context()).Preload("Permission").Order("id").Find(&roles).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, roles)
+}
+
+// writeOrgRoleError 角色权限不在 org 命名空间时返回 400
+func writeOrgRoleError(w http.ResponseWriter, err error) {
+	if err == models.ErrOrganizationPermission {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slog.Error(utils.DBErrorString, "err", err)
+	http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+}
+
+// 创建组织角色，只能包含 org 命名空间下的权限
+func handleCreateOrgRole(w http.ResponseWriter, r *http.Request) {
+	name := r.PostFormValue("name")
+	if name == "" {
+		http.Error(w, "Role name is required", http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := models.OrganizationPermissions(managers.DB, r.Form["permissionIds[]"])
+	if err != nil {
+		writeOrgRoleError(w, err)
+		return
+	}
+
+	tx := managers.DB.WithContext(r.Context())
+
+	var count int64
+	if err := tx.Model(&models.OrganizationRole{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Role name already exists", http.StatusConflict)
+		return
+	}
+
+	role := models.OrganizationRole{
+		Name:        name,
+		Description: r.PostFormValue("description"),
+		Permission:  permissions,
+	}
+	if err := tx.Create(&role).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, role)
+}
+
+// 更新组织角色的描述，传 permissionIds[] 时替换角色权限
+func handleUpdateOrgRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := managers.StringToID(r.PostFormValue("id"))
+	if err != nil {
+		http.Error(w, "Role ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tx := managers.DB.WithContext(r.Context())
+
+	var role models.OrganizationRole
+	if err := tx.First(&role, roleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Role not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, ok := r.PostForm["description"]; ok {
+		if err := tx.Model(&role).Update("description", r.PostFormValue("description")).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if _, ok := r.PostForm["permissionIds[]"]; ok {
+		permissions, err := models.OrganizationPermissions(managers.DB, r.Form["permissionIds[]"])
+		if err != nil {
+			writeOrgRoleError(w, err)
+			return
+		}
+		if err := tx.Model(&role).Association("Permission").Replace(permissions); err != nil {
+			msg := "Failed to assign permissions"
+			slog.Error(msg, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	utils.Sucess(w)
+}
+
+// 删除组织角色，已分配给成员的一并解除
+func handleDeleteOrgRole(w http.ResponseWriter, r *http.Request) {
+	roleID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Role ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.DeleteOrganizationRole(managers.DB.WithContext(r.Context()), roleID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Role not found", http.StatusNotFound)
+		} else {
+			msg := "Failed to delete role"
+			slog.Error(msg, "id", roleID, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.Sucess(w)
+}
@@ -0,0 +1,171 @@
+package routers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	resetIPLimit      = 10
+	resetAccountLimit = 3
+)
+
+// 忘记密码，向已验证的邮箱发送重置链接。无论账号是否存在都返回成功
+func handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account := r.PostFormValue("account")
+
+	if account == "" {
+		http.Error(w, "Username or email is required", http.StatusBadRequest)
+		return
+	}
+
+	ip := utils.ParseIP(r)
+	reply, err := utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.RESETIPLIMIT+ip, time.Hour)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if reply > resetIPLimit {
+		msg := "Too many password reset requests. Please try again later."
+		slog.Error(msg, "ip", ip)
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.
+		Where("username = ?", account).
+		Or("email = ? AND email_verified = ?", account, true).
+		First(&user).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		slog.Warn("Password reset for unknown account", "account", account, "ip", ip)
+		utils.Sucess(w)
+		return
+	}
+
+	id := managers.IDToString(user.ID)
+	reply, err = utils.IncreaseAndExpireNonatomic(managers.Redis, ctx, managers.RESETLIMIT+id, time.Hour)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if reply > resetAccountLimit {
+		slog.Warn("Password reset limit reached", "id", id, "ip", ip)
+		utils.Sucess(w)
+		return
+	}
+
+	if user.Email == "" || !user.EmailVerified {
+		slog.Warn("Password reset for account without verified email", "id", id)
+		utils.Sucess(w)
+		return
+	}
+
+	if err := models.SendPasswordReset(ctx, &user); err != nil {
+		msg := "Failed to send password reset email"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 通过重置令牌设置新密码，并吊销该用户的全部会话
+func handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.PostFormValue("token")
+	password := r.PostFormValue("password")
+
+	if token == "" || password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := models.PeekPasswordReset(ctx, token)
+	if err != nil {
+		if err == redis.Nil {
+			http.Error(w, "Reset link is invalid or has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Select("id", "username", "salt", "password").First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 新密码不符合策略时保留令牌，用户可以换个密码重试
+	if err := models.ValidatePassword(&user, password); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
+	if _, err := models.TakePasswordReset(ctx, token); err != nil {
+		if err == redis.Nil {
+			http.Error(w, "Reset link is invalid or has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := models.UpdatePassword(&user, password); err != nil {
+		writePasswordError(w, err)
+		return
+	}
+
+	if err := models.RevokeAllTokens(ctx, userID); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	managers.Redis.Del(ctx, managers.RESETLIMIT+userID)
+
+	event := models.UserEvent(userID, models.EventPasswordChange, models.OutcomeSuccess)
+	event.Detail = "reset"
+	models.RecordLoginEvent(r, event)
+
+	utils.Sucess(w)
+}
+
+// writePasswordError 密码不符合策略时返回全部违规项
+func writePasswordError(w http.ResponseWriter, err error) {
+	var policyErr *models.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		utils.FailWithData(w, http.StatusBadRequest, policyErr)
+		return
+	}
+
+	slog.Error(utils.DBErrorString, "err", err)
+	http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+}
@@ -1,33 +1,151 @@
 package routers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"server-go/managers"
 	"server-go/models"
+	"server-go/utils"
+	"strings"
+
+	"gorm.io/gorm"
 )
 
+// denyImpersonation 模拟登录的会话不能修改密码、两步验证等安全设置
+func denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(ImpersonatorID).(string); ok {
+			http.Error(w, "Forbidden: not allowed while impersonating", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// impersonationDenied 模拟登录的会话整组禁止访问的路由：管理后台、组织管理、OAuth 授权，
+// 以及会吊销用户其他会话、改变用户组织成员关系的接口。结束模拟登录的接口除外
+func impersonationDenied(path string) bool {
+	switch path {
+	case adminParty + "/impersonate/end":
+		return false
+	case accountParty + "/session",
+		accountParty + "/sessions/revoke-others",
+		accountParty + "/organization/select",
+		accountParty + "/organization/invitation/accept",
+		accountParty + "/organization/invitation/decline":
+		return true
+	}
+
+	for _, group := range []string{adminParty, orgParty, oauthParty} {
+		if path == group || strings.HasPrefix(path, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllows 个人访问令牌的 scope 是否包含该权限，scope 同样支持通配符；不是令牌请求时总是允许
+func scopeAllows(r *http.Request, permission string) bool {
+	scopes, ok := r.Context().Value(TokenScopes).([]string)
+	return !ok || models.NewPermissionMatcher(scopes).Match(permission)
+}
+
+// effectivePermissions 读取当前用户缓存的有效权限，失败时已写回响应
+func effectivePermissions(w http.ResponseWriter, r *http.Request) (*models.EffectivePermissions, bool) {
+	user, err := models.GetEffectivePermissions(r.Context(), r.Context().Value(UserID).(string))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			slog.Error("Failed to get user", "err", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		} else {
+			slog.Error("Failed to load permissions", "err", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
 // RequirePermission 权限检查中间件
 func RequirePermission(permission string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := r.Context().Value(UserID).(string)
+			user, ok := effectivePermissions(w, r)
+			if !ok {
+				return
+			}
+
+			if user.RequireTwoFactor && !user.TOTPEnabled {
+				http.Error(w, "Forbidden: two-factor authentication required", http.StatusForbidden)
+				return
+			}
+
+			if !user.HasPermission(permission) {
+				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			// 个人访问令牌只能使用其 scope 与用户权限的交集
+			if !scopeAllows(r, permission) {
+				http.Error(w, "Forbidden: token scope does not include this permission", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResourceLoader 从请求中加载被访问的资源，参数错误时返回 errResourceParams，不存在时返回 gorm.ErrRecordNotFound
+type ResourceLoader func(r *http.Request) (*models.Resource, error)
+
+var errResourceParams = errors.New(utils.ParamsWrongString)
+
+// RequirePolicy 按资源属性检查权限的中间件。拥有全局权限且没有 deny 策略命中，
+// 或者有 allow 策略命中时放行，详见 models.Authorize
+func RequirePolicy(action string, loader ResourceLoader) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := effectivePermissions(w, r)
+			if !ok {
+				return
+			}
+
+			if user.RequireTwoFactor && !user.TOTPEnabled {
+				http.Error(w, "Forbidden: two-factor authentication required", http.StatusForbidden)
+				return
+			}
+
+			if !scopeAllows(r, action) {
+				http.Error(w, "Forbidden: token scope does not include this permission", http.StatusForbidden)
+				return
+			}
 
-			var user models.User
-			if err := managers.DB.First(&user, userID).Error; err != nil {
-				slog.Error("Failed to get user", "err", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			resource, err := loader(r)
+			if err != nil {
+				switch {
+				case errors.Is(err, errResourceParams):
+					http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+				case errors.Is(err, gorm.ErrRecordNotFound):
+					http.Error(w, "Resource not found", http.StatusNotFound)
+				default:
+					slog.Error("Failed to load resource", "action", action, "err", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
 				return
 			}
 
-			// 加载权限
-			if err := user.LoadPermissions(); err != nil {
-				slog.Error("Failed to load permissions", "err", err)
+			allowed, err := models.AuthorizeWith(r.Context().Value(UserID).(string), user, action, resource)
+			if err != nil {
+				slog.Error("Failed to evaluate policies", "action", action, "err", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
 
-			if !user.HasPermission(permission) {
+			if !allowed {
 				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
 				return
 			}
@@ -37,23 +155,87 @@ func RequirePermission(permission string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireOrgPermission 组织内权限检查中间件。会话必须已选择组织，权限只来自成员在该组织内的角色，
+// 拥有全局 manage_organizations 权限的管理员可以管理任意组织。
+// 通过后 context 带上组织 ID，之后 managers.DB.WithContext(r.Context()) 的查询自动按组织隔离
+func RequireOrgPermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value, _ := r.Context().Value(OrganizationID).(string)
+			organizationID, err := managers.StringToID(value)
+			if value == "" || err != nil {
+				http.Error(w, "No organization selected", http.StatusBadRequest)
+				return
+			}
+
+			user, ok := effectivePermissions(w, r)
+			if !ok {
+				return
+			}
+
+			if user.RequireTwoFactor && !user.TOTPEnabled {
+				http.Error(w, "Forbidden: two-factor authentication required", http.StatusForbidden)
+				return
+			}
+
+			if !scopeAllows(r, permission) {
+				http.Error(w, "Forbidden: token scope does not include this permission", http.StatusForbidden)
+				return
+			}
+
+			userID := r.Context().Value(UserID).(string)
+			ctx := managers.WithTenant(r.Context(), organizationID)
+
+			member, err := models.FindOrganizationMember(managers.DB.WithContext(ctx), userID)
+			if err != nil && err != gorm.ErrRecordNotFound {
+				slog.Error(utils.DBErrorString, "err", err)
+				http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+				return
+			}
+
+			switch {
+			case member != nil && member.PermissionMatcher().Match(permission):
+			case user.HasPermission("manage_organizations"):
+				// 组织可能已被删除
+				if err := managers.DB.Select("id").First(&models.Organization{}, organizationID).Error; err != nil {
+					if err == gorm.ErrRecordNotFound {
+						http.Error(w, "Organization not found", http.StatusNotFound)
+					} else {
+						slog.Error(utils.DBErrorString, "err", err)
+						http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+					}
+					return
+				}
+			case member == nil:
+				http.Error(w, "Forbidden: not a member of this organization", http.StatusForbidden)
+				return
+			default:
+				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 // RequireRole 角色检查中间件
 func RequireRole(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID := r.Context().Value(UserID).(string)
+			user, ok := effectivePermissions(w, r)
+			if !ok {
+				return
+			}
 
-			var user models.User
-			if err := managers.DB.First(&user, userID).Error; err != nil {
-				slog.Error("Failed to get user", "err", err)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if user.RequireTwoFactor && !user.TOTPEnabled {
+				http.Error(w, "Forbidden: two-factor authentication required", http.StatusForbidden)
 				return
 			}
 
-			// 加载角色
-			if err := managers.DB.Preload("Role").First(&user, user.ID).Error; err != nil {
-				slog.Error("Failed to load roles", "err", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			// 角色无法按 scope 收窄，个人访问令牌不能访问
+			if _, ok := r.Context().Value(TokenScopes).([]string); ok {
+				http.Error(w, "Forbidden: personal access tokens cannot use role-protected endpoints", http.StatusForbidden)
 				return
 			}
 
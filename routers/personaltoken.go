@@ -0,0 +1,110 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func personalTokens() {
+	models.PersonalTokenInit()
+
+	http.Handle(accountParty+"/tokens", utils.CORS(verify(denyImpersonation(utils.Methods(
+		utils.Get(http.HandlerFunc(handleListPersonalTokens)),
+		utils.Post(http.HandlerFunc(handleCreatePersonalToken)),
+	))), http.MethodGet, http.MethodPost))
+	http.Handle(accountParty+"/token", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleRevokePersonalToken))), http.MethodDelete))
+}
+
+// 获取当前用户的个人访问令牌
+func handleListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := models.ListPersonalTokens(r.Context().Value(UserID).(string))
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, tokens)
+}
+
+// 签发个人访问令牌，有效期单位为天
+func handleCreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+	name := r.PostFormValue("name")
+	scopes := r.Form["scopes[]"]
+
+	days, err := strconv.Atoi(r.PostFormValue("expiresIn"))
+	if name == "" || err != nil || days <= 0 {
+		http.Error(w, "Name and a positive expiresIn (days) are required", http.StatusBadRequest)
+		return
+	}
+
+	life := time.Duration(days) * 24 * time.Hour
+	if life > models.PersonalTokenMaxLife {
+		http.Error(w, "Token lifetime must not exceed 365 days", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := user.LoadPermissions(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	token, record, err := models.NewPersonalToken(&user, name, scopes, life)
+	if err != nil {
+		if err == models.ErrPersonalTokenScope {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"token":    token,
+		"metadata": record,
+	})
+}
+
+// 吊销个人访问令牌
+func handleRevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Token ID is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := models.RevokePersonalToken(r.Context().Value(UserID).(string), id)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
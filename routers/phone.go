@@ -0,0 +1,271 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const smsIPLimit = 10
+
+func phone() {
+	http.Handle(accountParty+"/phone/verify", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleSendPhoneVerification))), http.MethodPost))
+	http.Handle(accountParty+"/phone/confirm", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleConfirmPhone))), http.MethodPost))
+
+	if managers.Config.SMS.LoginEnabled {
+		http.Handle(accountParty+"/login/sms/send", utils.CORS(http.HandlerFunc(handleSendLoginCode), http.MethodPost))
+		http.Handle(accountParty+"/login/sms", utils.CORS(http.HandlerFunc(handleLoginSMS), http.MethodPost))
+	}
+}
+
+// writePhoneCodeError 验证码相关的业务错误返回给客户端，其余按缓存错误处理
+func writePhoneCodeError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrSMSCooldown, models.ErrPhoneCodeTries:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case models.ErrPhoneCode:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error("Failed to process sms code", "err", err)
+		http.Error(w, "Failed to process sms code", http.StatusInternalServerError)
+	}
+}
+
+// limitSMSIP 按 IP 限制发送短信的次数，超限时已写回响应
+func limitSMSIP(w http.ResponseWriter, r *http.Request) bool {
+	ip := utils.ParseIP(r)
+	reply, err := utils.IncreaseAndExpireNonatomic(managers.Redis, r.Context(), managers.SMSIPLIMIT+ip, time.Hour)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return false
+	}
+
+	if reply > smsIPLimit {
+		msg := "Too many sms requests. Please try again later."
+		slog.Error(msg, "ip", ip)
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+// 向新号码发送验证码，不传号码时发送到当前未验证的号码
+func handleSendPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	number := r.PostFormValue("phoneNumber")
+
+	if number == "" {
+		var user models.User
+		if err := managers.DB.Select("id", "phone_number", "phone_verified").First(&user, userID).Error; err != nil {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+		if user.PhoneNumber == "" || user.PhoneVerified {
+			http.Error(w, "No phone number to verify", http.StatusBadRequest)
+			return
+		}
+		number = user.PhoneNumber
+	}
+
+	phone, err := models.NormalizePhone(number)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	taken, err := models.PhoneTaken(phone, userID)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, models.ErrPhoneTaken.Error(), http.StatusConflict)
+		return
+	}
+
+	if !limitSMSIP(w, r) {
+		return
+	}
+
+	if err := models.SendPhoneCode(ctx, models.PhoneCodeVerify, phone, userID); err != nil {
+		writePhoneCodeError(w, err)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]string{"phoneNumber": phone})
+}
+
+// 提交验证码，通过后写入号码并标记为已验证
+func handleConfirmPhone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	code := r.PostFormValue("code")
+
+	phone, err := models.NormalizePhone(r.PostFormValue("phoneNumber"))
+	if err != nil || code == "" {
+		http.Error(w, "Phone number and code are required", http.StatusBadRequest)
+		return
+	}
+
+	owner, err := models.VerifyPhoneCode(ctx, models.PhoneCodeVerify, phone, code)
+	if err != nil {
+		writePhoneCodeError(w, err)
+		return
+	}
+
+	// 验证码发给了别的用户
+	if owner != userID {
+		http.Error(w, models.ErrPhoneCode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.ConfirmPhone(&user, phone); err != nil {
+		if err == models.ErrPhoneTaken {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.SucessWithData(w, user)
+}
+
+// 发送登录验证码。无论号码是否注册都返回成功
+func handleSendLoginCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	phone, err := models.NormalizePhone(r.PostFormValue("phoneNumber"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !passChallenge(w, r, models.ChallengeLogin) {
+		return
+	}
+
+	if !limitSMSIP(w, r) {
+		return
+	}
+
+	user, err := models.FindUserByPhone(phone)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		slog.Warn("Login code for unknown phone number", "phone", phone, "ip", utils.ParseIP(r))
+		utils.Sucess(w)
+		return
+	}
+
+	if err := models.SendPhoneCode(ctx, models.PhoneCodeLogin, phone, managers.IDToString(user.ID)); err != nil {
+		// 冷却中同样返回成功，避免借此判断号码是否注册
+		if err == models.ErrSMSCooldown {
+			utils.Sucess(w)
+			return
+		}
+		writePhoneCodeError(w, err)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 通过短信验证码登录，开启了两步验证时仍需第二步
+func handleLoginSMS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := r.PostFormValue("code")
+
+	phone, err := models.NormalizePhone(r.PostFormValue("phoneNumber"))
+	if err != nil || code == "" {
+		http.Error(w, "Phone number and code are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := models.VerifyPhoneCode(ctx, models.PhoneCodeLogin, phone, code)
+	if err != nil {
+		if err == models.ErrPhoneCode || err == models.ErrPhoneCodeTries {
+			models.RecordLoginEvent(r, &models.LoginEvent{
+				Username: phone,
+				Type:     models.EventLogin,
+				Outcome:  models.OutcomeFailure,
+				Method:   models.LoginMethodSMS,
+			})
+		}
+		writePhoneCodeError(w, err)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 号码在发送验证码后被解绑
+	if !user.PhoneVerified || user.PhoneNumber != phone {
+		http.Error(w, models.ErrPhoneCode.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if user.Suspended() {
+		event := models.UserEvent(userID, models.EventLogin, models.OutcomeBlocked)
+		event.Username, event.Method, event.Detail = user.Username, models.LoginMethodSMS, "suspended"
+		models.RecordLoginEvent(r, event)
+
+		http.Error(w, models.ErrUserSuspended.Error(), http.StatusForbidden)
+		return
+	}
+
+	if user.TOTPEnabled {
+		if loginThrottled(w, r, &models.LoginEvent{UserID: user.ID, Username: user.Username, Method: models.LoginMethodSMS}) {
+			return
+		}
+
+		pendingToken, err := models.NewPendingLogin(ctx, userID)
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		event := models.UserEvent(userID, models.EventTwoFactor, models.OutcomeIssued)
+		event.Username, event.Method = user.Username, models.LoginMethodSMS
+		models.RecordLoginEvent(r, event)
+
+		utils.SucessWithData(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"pendingToken":      pendingToken,
+		})
+		return
+	}
+
+	finishLogin(w, r, &user, utils.ParseIP(r), models.LoginMethodSMS)
+}
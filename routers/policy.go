@@ -0,0 +1,173 @@
+package routers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+
+	"gorm.io/gorm"
+)
+
+func policies() {
+	models.PolicyInit()
+
+	http.Handle(adminParty+"/policies", utils.CORS(verifyScoped(RequirePermission("manage_policies")(http.HandlerFunc(handleListPolicies))), http.MethodGet))
+	http.Handle(adminParty+"/policy", utils.CORS(verifyScoped(RequirePermission("manage_policies")(http.HandlerFunc(handleCreatePolicy))), http.MethodPost))
+	http.Handle(adminParty+"/policy/update", utils.CORS(verifyScoped(RequirePermission("manage_policies")(http.HandlerFunc(handleUpdatePolicy))), http.MethodPut))
+	http.Handle(adminParty+"/policy/delete", utils.CORS(verifyScoped(RequirePermission("manage_policies")(http.HandlerFunc(handleDeletePolicy))), http.MethodDelete))
+}
+
+// writePolicyError 校验失败返回 400，其余按数据库错误处理
+func writePolicyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrPolicyEffect) || errors.Is(err, models.ErrPermissionName) || errors.Is(err, utils.ErrExprSyntax) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	slog.Error(utils.DBErrorString, "err", err)
+	http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+}
+
+// invalidatePolicies 策略已保存，广播失败只记录日志，其他实例最多延迟一个缓存周期
+func invalidatePolicies(r *http.Request) {
+	if err := models.InvalidatePolicies(r.Context()); err != nil {
+		slog.Error("Failed to invalidate policy cache", "err", err)
+	}
+}
+
+// 获取所有策略
+func handleListPolicies(w http.ResponseWriter, r *http.Request) {
+	var policies []models.Policy
+	if err := managers.DB.Order("id").Find(&policies).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, policies)
+}
+
+// 创建策略，条件表达式在保存前校验
+func handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
+	policy := models.Policy{
+		Name:         r.PostFormValue("name"),
+		Description:  r.PostFormValue("description"),
+		Action:       r.PostFormValue("action"),
+		ResourceType: r.PostFormValue("resourceType"),
+		Effect:       r.PostFormValue("effect"),
+		Condition:    r.PostFormValue("condition"),
+		Enabled:      r.PostFormValue("enabled") != "false",
+	}
+
+	if policy.Name == "" {
+		http.Error(w, "Policy name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := policy.Validate(); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	var count int64
+	if err := managers.DB.Model(&models.Policy{}).Where("name = ?", policy.Name).Count(&count).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Policy name already exists", http.StatusConflict)
+		return
+	}
+
+	if err := managers.DB.Create(&policy).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePolicies(r)
+
+	utils.SucessWithData(w, policy)
+}
+
+// 更新策略，只修改传了的字段
+func handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	policyID, err := managers.StringToID(r.PostFormValue("id"))
+	if err != nil {
+		http.Error(w, "Policy ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var policy models.Policy
+	if err := managers.DB.First(&policy, policyID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Policy not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if _, ok := r.PostForm["description"]; ok {
+		policy.Description = r.PostFormValue("description")
+	}
+	if _, ok := r.PostForm["action"]; ok {
+		policy.Action = r.PostFormValue("action")
+	}
+	if _, ok := r.PostForm["resourceType"]; ok {
+		policy.ResourceType = r.PostFormValue("resourceType")
+	}
+	if _, ok := r.PostForm["effect"]; ok {
+		policy.Effect = r.PostFormValue("effect")
+	}
+	if _, ok := r.PostForm["condition"]; ok {
+		policy.Condition = r.PostFormValue("condition")
+	}
+	if _, ok := r.PostForm["enabled"]; ok {
+		policy.Enabled = r.PostFormValue("enabled") != "false"
+	}
+
+	if err := policy.Validate(); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	if err := managers.DB.Save(&policy).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePolicies(r)
+
+	utils.SucessWithData(w, policy)
+}
+
+// 删除策略
+func handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+	policyID, err := managers.StringToID(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Policy ID is required", http.StatusBadRequest)
+		return
+	}
+
+	result := managers.DB.Delete(&models.Policy{}, policyID)
+	if result.Error != nil {
+		slog.Error(utils.DBErrorString, "err", result.Error)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Policy not found", http.StatusNotFound)
+		return
+	}
+
+	invalidatePolicies(r)
+
+	utils.Sucess(w)
+}
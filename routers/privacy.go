@@ -0,0 +1,188 @@
+package routers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var avatarClient = &http.Client{Timeout: 30 * time.Second}
+
+func privacy() {
+	http.Handle(accountParty+"/export", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleExportAccount))), http.MethodGet))
+	http.Handle(accountParty+"/delete", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleDeleteAccount))), http.MethodPost))
+	http.Handle(accountParty+"/delete/cancel", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleCancelAccountDeletion))), http.MethodPost))
+
+	models.StartAccountPurger()
+}
+
+// 导出个人数据，format=zip 时打包头像文件
+func handleExportAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+
+	data, err := models.ExportUserData(ctx, userID, ctx.Value(SessionToken).(string))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error("Failed to export user data", "err", err)
+			http.Error(w, "Failed to export user data", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	filename := "account-" + userID + "-" + time.Now().Format("20060102")
+
+	if r.URL.Query().Get("format") != "zip" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		utils.SucessWithData(w, data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	file, err := archive.Create("account.json")
+	if err != nil {
+		slog.Error("Failed to write export archive", "err", err)
+		return
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		slog.Error("Failed to write export archive", "err", err)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.Select("id", "avatar").First(&user, userID).Error; err != nil || user.AvatarPath == "" {
+		return
+	}
+
+	if err := writeAvatar(r, archive, user.GetAvatarURL(ctx), path.Base(user.AvatarPath)); err != nil {
+		slog.Error("Failed to add avatar to export archive", "id", userID, "err", err)
+	}
+}
+
+func writeAvatar(r *http.Request, archive *zip.Writer, url string, name string) error {
+	if url == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := avatarClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, res.Body)
+	return err
+}
+
+// 申请注销账号，需要重新验证密码，开启了两步验证时还需要验证码
+func handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	password := r.PostFormValue("password")
+	code := r.PostFormValue("code")
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if len(user.Password) == 0 && !user.TOTPEnabled {
+		http.Error(w, "Set a password before deleting your account", http.StatusForbidden)
+		return
+	}
+
+	if len(user.Password) > 0 {
+		if ok, _ := user.CheckPassword(password); !ok {
+			http.Error(w, "Password is incorrect", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if user.TOTPEnabled {
+		ok, err := user.VerifyTOTP(ctx, code)
+		if err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Code is incorrect", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := models.ScheduleDeletion(ctx, &user); err != nil {
+		slog.Error("Failed to schedule account deletion", "id", userID, "err", err)
+		http.Error(w, "Failed to schedule account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Account deletion scheduled", "id", userID)
+	utils.SucessWithData(w, map[string]interface{}{
+		"purgeAt": user.DeletionRequestedAt.Add(models.DeletionGracePeriod()),
+	})
+}
+
+// 宽限期内撤销注销申请
+func handleCancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+
+	var user models.User
+	if err := managers.DB.Select("id", "deletion_requested_at").First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if user.DeletionRequestedAt == nil {
+		http.Error(w, "Account deletion is not scheduled", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.CancelDeletion(&user); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
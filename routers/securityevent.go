@@ -0,0 +1,94 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"server-go/models"
+	"server-go/utils"
+	"strconv"
+	"time"
+)
+
+func securityEvents() {
+	http.Handle(accountParty+"/security-events", utils.CORS(verify(http.HandlerFunc(handleListSecurityEvents)), http.MethodGet))
+	http.Handle(adminParty+"/security-events", utils.CORS(verifyScoped(RequirePermission("manage_users")(http.HandlerFunc(handleAdminListSecurityEvents))), http.MethodGet))
+}
+
+// parseEventFilter 解析分页和通用过滤参数，时间使用 RFC 3339 格式
+func parseEventFilter(query url.Values) (models.LoginEventFilter, bool) {
+	filter := models.LoginEventFilter{
+		Type:    query.Get("type"),
+		Outcome: query.Get("outcome"),
+	}
+
+	var err error
+	if value := query.Get("page"); value != "" {
+		if filter.Page, err = strconv.Atoi(value); err != nil {
+			return filter, false
+		}
+	}
+	if value := query.Get("pageSize"); value != "" {
+		if filter.PageSize, err = strconv.Atoi(value); err != nil {
+			return filter, false
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, false
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, false
+		}
+		filter.To = &to
+	}
+
+	return filter, true
+}
+
+func writeEventPage(w http.ResponseWriter, filter models.LoginEventFilter) {
+	events, total, err := models.ListLoginEvents(filter)
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"total":  total,
+		"events": events,
+	})
+}
+
+// 分页获取当前用户的安全事件
+func handleListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseEventFilter(r.URL.Query())
+	if !ok {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+	filter.UserID = r.Context().Value(UserID).(string)
+
+	writeEventPage(w, filter)
+}
+
+// 管理员按用户、用户名、IP 等条件查询安全事件
+func handleAdminListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, ok := parseEventFilter(query)
+	if !ok {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+	filter.UserID = query.Get("userId")
+	filter.Username = query.Get("username")
+	filter.IP = query.Get("ip")
+
+	writeEventPage(w, filter)
+}
@@ -0,0 +1,76 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/models"
+	"server-go/utils"
+	"strconv"
+)
+
+func sessions() {
+	http.Handle(accountParty+"/sessions", utils.CORS(verify(http.HandlerFunc(handleListSessions)), http.MethodGet))
+	http.Handle(accountParty+"/session", utils.CORS(verify(http.HandlerFunc(handleRevokeSession)), http.MethodDelete))
+	http.Handle(accountParty+"/sessions/revoke-others", utils.CORS(verify(http.HandlerFunc(handleRevokeOtherSessions)), http.MethodPost))
+}
+
+// 获取当前用户的登录会话
+func handleListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	sessions, err := models.ListSessions(ctx, ctx.Value(UserID).(string), ctx.Value(SessionToken).(string))
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, sessions)
+}
+
+// 吊销指定会话
+func handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sessionID := r.URL.Query().Get("id")
+
+	if sessionID == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := models.RevokeSession(ctx, ctx.Value(UserID).(string), sessionID)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	event := models.UserEvent(ctx.Value(UserID).(string), models.EventSessionRevoke, models.OutcomeSuccess)
+	event.Detail = "session " + sessionID
+	models.RecordLoginEvent(r, event)
+
+	utils.Sucess(w)
+}
+
+// 吊销除当前会话外的所有会话
+func handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	count, err := models.RevokeOtherTokens(ctx, ctx.Value(UserID).(string), ctx.Value(SessionToken).(string))
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	event := models.UserEvent(ctx.Value(UserID).(string), models.EventSessionRevoke, models.OutcomeSuccess)
+	event.Detail = "other sessions: " + strconv.Itoa(count)
+	models.RecordLoginEvent(r, event)
+
+	utils.SucessWithData(w, map[string]int{"revoked": count})
+}
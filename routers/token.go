@@ -0,0 +1,136 @@
+package routers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+)
+
+func tokens() {
+	http.Handle(accountParty+"/token/refresh", utils.CORS(http.HandlerFunc(handleRefreshToken), http.MethodPost))
+	http.Handle(accountParty+"/token/revoke", utils.CORS(http.HandlerFunc(handleRevokeRefreshToken), http.MethodPost))
+
+	http.Handle("/.well-known/jwks.json", utils.CORS(http.HandlerFunc(handleJWKS), http.MethodGet))
+}
+
+// issueTokenPair 签发访问令牌和刷新令牌，失败时已写回错误并返回 false
+func issueTokenPair(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	userID := managers.IDToString(user.ID)
+
+	access, err := models.NewAccessToken(userID, "")
+	if err != nil {
+		msg := "Failed to sign access token"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return false
+	}
+
+	refresh, err := models.NewRefreshToken(r.Context(), userID)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return false
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"accessToken":  access,
+		"tokenType":    "Bearer",
+		"expiresIn":    managers.Config.JWT.AccessLife,
+		"refreshToken": refresh,
+		"user":         user,
+	})
+	return true
+}
+
+// 用刷新令牌换取新的令牌对
+func handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if !managers.Config.JWT.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	refreshToken := r.PostFormValue("refreshToken")
+	if refreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, refresh, err := models.RotateRefreshToken(r.Context(), refreshToken)
+	if err != nil {
+		switch err {
+		case models.ErrRefreshInvalid:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case models.ErrRefreshReused:
+			slog.Error("Refresh token reuse detected", "id", userID, "ip", utils.ParseIP(r))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 刷新令牌不记录所选组织，客户端刷新时重新带上；已无权访问时签发不带组织的令牌
+	organizationID := ""
+	if value := r.PostFormValue("organizationId"); value != "" {
+		if id, err := managers.StringToID(value); err == nil {
+			ok, err := models.CanAccessOrganization(r.Context(), userID, id)
+			if err != nil {
+				slog.Error("Failed to check organization access", "id", userID, "err", err)
+			} else if ok {
+				organizationID = managers.IDToString(id)
+			}
+		}
+	}
+
+	access, err := models.NewAccessToken(userID, organizationID)
+	if err != nil {
+		msg := "Failed to sign access token"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"accessToken":    access,
+		"tokenType":      "Bearer",
+		"expiresIn":      managers.Config.JWT.AccessLife,
+		"refreshToken":   refresh,
+		"organizationId": organizationID,
+	})
+}
+
+// 作废刷新令牌（令牌模式下的登出）
+func handleRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
+	if !managers.Config.JWT.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	refreshToken := r.PostFormValue("refreshToken")
+	if refreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.RevokeRefreshToken(r.Context(), refreshToken); err != nil && err != models.ErrRefreshInvalid {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 发布验签公钥
+func handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{utils.JWK(managers.JWTKey.Public(), managers.JWTKeyID)},
+	})
+}
@@ -0,0 +1,383 @@
+package routers
+
+import (
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const twoFactorSetupLife = 10 * time.Minute
+
+func twoFactor() {
+	models.TwoFactorInit()
+
+	http.Handle(accountParty+"/2fa", utils.CORS(verify(http.HandlerFunc(handleTwoFactorStatus)), http.MethodGet))
+	http.Handle(accountParty+"/2fa/setup", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleTwoFactorSetup))), http.MethodPost))
+	http.Handle(accountParty+"/2fa/confirm", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleTwoFactorConfirm))), http.MethodPost))
+	http.Handle(accountParty+"/2fa/disable", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleTwoFactorDisable))), http.MethodPost))
+	http.Handle(accountParty+"/2fa/recovery-codes", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleTwoFactorRecoveryCodes))), http.MethodPost))
+
+	// 登录第二步
+	http.Handle(accountParty+"/login/2fa", utils.CORS(http.HandlerFunc(handleLoginTwoFactor), http.MethodPost))
+
+	// 管理员为角色设置两步验证要求
+	http.Handle(adminParty+"/role/2fa", utils.CORS(verifyScoped(RequirePermission("manage_roles")(http.HandlerFunc(handleRoleRequireTwoFactor))), http.MethodPut))
+}
+
+// 获取两步验证状态
+func handleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := user.LoadPermissions(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	var remaining int64
+	if err := managers.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"enabled":            user.TOTPEnabled,
+		"required":           user.RequiresTwoFactor(),
+		"recoveryCodesCount": remaining,
+	})
+}
+
+// 开始绑定认证器，返回密钥和 otpauth URI
+func handleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret := utils.TOTPSecret()
+	if err := managers.Redis.Set(r.Context(), managers.TOTPSETUP+userID, secret, twoFactorSetupLife).Err(); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]string{
+		"secret": secret,
+		"uri":    utils.TOTPURI(models.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// 用第一个验证码确认绑定，并返回恢复码
+func handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	code := r.PostFormValue("code")
+
+	if code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := managers.Redis.Get(ctx, managers.TOTPSETUP+userID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			http.Error(w, "Two-factor setup has expired", http.StatusBadRequest)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	user.TOTPSecret = secret
+	ok, err := user.VerifyTOTP(ctx, code)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Code is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	if err := managers.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":  secret,
+		"totp_enabled": true,
+	}).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	managers.Redis.Del(ctx, managers.TOTPSETUP+userID)
+
+	// 缓存中的 totpEnabled 过期前，要求两步验证的角色仍会被拦下，不影响返回恢复码
+	if err := models.InvalidatePermissions(ctx, userID); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+	}
+
+	codes, err := user.NewRecoveryCodes()
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// 关闭两步验证，需要密码和当前验证码
+func handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	password := r.PostFormValue("password")
+	code := r.PostFormValue("code")
+
+	if password == "" || code == "" {
+		http.Error(w, "Password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := user.LoadPermissions(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if user.RequiresTwoFactor() {
+		http.Error(w, "Two-factor authentication is required by your role", http.StatusForbidden)
+		return
+	}
+
+	if ok, _ := user.CheckPassword(password); !ok {
+		http.Error(w, "Password is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := user.VerifyTOTP(ctx, code)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Code is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	if err := user.DisableTwoFactor(); err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.InvalidatePermissions(ctx, managers.IDToString(user.ID)); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 重新生成恢复码
+func handleTwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+	code := r.PostFormValue("code")
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := user.VerifyTOTP(ctx, code)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Code is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := user.NewRecoveryCodes()
+	if err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// 登录第二步：校验待定登录令牌和动态验证码（或恢复码）
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	pendingToken := r.PostFormValue("pendingToken")
+	code := r.PostFormValue("code")
+	recoveryCode := r.PostFormValue("recoveryCode")
+
+	if pendingToken == "" || (code == "" && recoveryCode == "") {
+		msg := "pending token and code are required"
+		slog.Error(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	userID, tries, err := models.PendingLoginUser(ctx, pendingToken)
+	if err != nil {
+		if err == redis.Nil {
+			msg := "Login has expired, please sign in again"
+			slog.Error(msg)
+			http.Error(w, msg, http.StatusUnauthorized)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if tries > models.PendingLoginTries {
+		models.ClosePendingLogin(ctx, pendingToken)
+		msg := "Too many attempts, please sign in again"
+		slog.Error(msg, "id", userID)
+		http.Error(w, msg, http.StatusTooManyRequests)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	method := models.LoginMethodTOTP
+	if recoveryCode != "" {
+		method = models.LoginMethodRecoveryCode
+	}
+
+	// 失败计入用户名，锁定后已签发的待定登录令牌也不能继续尝试
+	if loginThrottled(w, r, &models.LoginEvent{UserID: user.ID, Username: user.Username, Method: method}) {
+		return
+	}
+
+	var ok bool
+	if recoveryCode != "" {
+		ok, err = user.UseRecoveryCode(recoveryCode)
+	} else {
+		ok, err = user.VerifyTOTP(ctx, code)
+	}
+	if err != nil {
+		slog.Error("Failed to verify second factor", "err", err)
+		http.Error(w, "Failed to verify second factor", http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		event := models.UserEvent(userID, models.EventTwoFactor, models.OutcomeFailure)
+		event.Username, event.Method = user.Username, method
+		models.RecordLoginEvent(r, event)
+
+		if err := models.RecordLoginFailure(ctx, user.Username); err != nil {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		msg := "Code is incorrect"
+		slog.Error(msg, "id", userID, "tries", tries)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := models.ClosePendingLogin(ctx, pendingToken); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	finishLogin(w, r, &user, utils.ParseIP(r), method)
+}
+
+// 设置角色是否要求两步验证
+func handleRoleRequireTwoFactor(w http.ResponseWriter, r *http.Request) {
+	roleID, idErr := managers.StringToID(r.PostFormValue("id"))
+	required, err := strconv.ParseBool(r.PostFormValue("required"))
+
+	if idErr != nil || err != nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	if err := managers.DB.Model(&models.Role{}).Where("id = ?", roleID).Update("require_two_factor", required).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.InvalidateRolePermissions(r.Context(), roleID); err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.Sucess(w)
+}
@@ -0,0 +1,403 @@
+package routers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"server-go/managers"
+	"server-go/models"
+	"server-go/utils"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const webauthnParty = accountParty + "/webauthn"
+
+func webauthn() {
+	models.WebAuthnInit()
+
+	// 注册
+	http.Handle(webauthnParty+"/register/begin", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleWebAuthnRegisterBegin))), http.MethodPost))
+	http.Handle(webauthnParty+"/register/finish", utils.CORS(verify(denyImpersonation(http.HandlerFunc(handleWebAuthnRegisterFinish))), http.MethodPost))
+
+	// 登录
+	http.Handle(webauthnParty+"/login/begin", utils.CORS(http.HandlerFunc(handleWebAuthnLoginBegin), http.MethodPost))
+	http.Handle(webauthnParty+"/login/finish", utils.CORS(http.HandlerFunc(handleWebAuthnLoginFinish), http.MethodPost))
+
+	// 通行密钥管理
+	http.Handle(webauthnParty+"/credentials", utils.CORS(verify(http.HandlerFunc(handleListWebAuthnCredentials)), http.MethodGet))
+	http.Handle(webauthnParty+"/credential", utils.CORS(verify(denyImpersonation(utils.Methods(
+		utils.Put(http.HandlerFunc(handleRenameWebAuthnCredential)),
+		utils.Delete(http.HandlerFunc(handleDeleteWebAuthnCredential)),
+	))), http.MethodPut, http.MethodDelete))
+}
+
+func decodeWebAuthnField(r *http.Request, name string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(r.PostFormValue(name))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// 开始注册通行密钥，返回 PublicKeyCredentialCreationOptions
+func handleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+
+	var user models.User
+	if err := managers.DB.First(&user, userID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := managers.DB.Select("credential_id").Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	challenge, err := models.NewWebAuthnChallenge(ctx, managers.WAREG, userID)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	exclude := make([]map[string]string, len(credentials))
+	for i, credential := range credentials {
+		exclude[i] = map[string]string{
+			"type": "public-key",
+			"id":   base64.RawURLEncoding.EncodeToString(credential.CredentialID),
+		}
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"challenge": challenge,
+		"rp":        map[string]string{"id": models.WebAuthnRPID(), "name": models.TOTPIssuer},
+		"user": map[string]string{
+			"id":          models.WebAuthnUserHandle(user.ID),
+			"name":        user.Username,
+			"displayName": displayName,
+		},
+		"pubKeyCredParams": []map[string]interface{}{
+			{"type": "public-key", "alg": utils.COSEAlgEdDSA},
+			{"type": "public-key", "alg": utils.COSEAlgES256},
+		},
+		"timeout":            models.WebAuthnChallengeLife.Milliseconds(),
+		"attestation":        "none",
+		"excludeCredentials": exclude,
+		"authenticatorSelection": map[string]string{
+			"residentKey": "preferred",
+			// 通行密钥单独用于登录，必须验证用户（PIN 或生物识别），否则只是单因素
+			"userVerification": "required",
+		},
+	})
+}
+
+// 完成注册，校验 clientDataJSON 和 attestationObject 后保存凭据
+func handleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserID).(string)
+
+	clientDataJSON := decodeWebAuthnField(r, "clientDataJSON")
+	attestationObject := decodeWebAuthnField(r, "attestationObject")
+	name := r.PostFormValue("name")
+
+	if clientDataJSON == nil || attestationObject == nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	clientData, err := utils.ParseClientData(clientDataJSON)
+	if err != nil || clientData.Type != "webauthn.create" || !models.WebAuthnOrigin(clientData.Origin) {
+		msg := "Invalid client data"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	owner, err := models.TakeWebAuthnChallenge(ctx, managers.WAREG, clientData.Challenge)
+	if err != nil || owner != userID {
+		msg := "Challenge is invalid or has expired"
+		slog.Error(msg, "err", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, rawAuthData, err := utils.ParseAttestationObject(attestationObject)
+	if err != nil {
+		http.Error(w, "Invalid attestation object", http.StatusBadRequest)
+		return
+	}
+
+	authData, err := utils.ParseAuthenticatorData(rawAuthData)
+	if err != nil || authData.CredentialID == nil {
+		http.Error(w, "Invalid authenticator data", http.StatusBadRequest)
+		return
+	}
+
+	if !authData.CheckRPIDHash(models.WebAuthnRPID()) || !authData.UserVerified() {
+		http.Error(w, "Invalid authenticator data", http.StatusBadRequest)
+		return
+	}
+
+	alg, err := utils.COSEAlgorithm(authData.PublicKey)
+	if err != nil {
+		http.Error(w, "Unsupported credential algorithm", http.StatusBadRequest)
+		return
+	}
+
+	id, _ := managers.StringToID(userID)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	credential := models.WebAuthnCredential{
+		UserID:       id,
+		CredentialID: authData.CredentialID,
+		PublicKey:    authData.PublicKey,
+		Algorithm:    alg,
+		SignCount:    authData.SignCount,
+		Name:         name,
+	}
+
+	if err := managers.DB.Create(&credential).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, credential)
+}
+
+// 开始通行密钥登录。带用户名时限定该用户的凭据，否则走可发现凭据
+func handleWebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	username := r.PostFormValue("username")
+
+	var userID string
+	allow := []map[string]string{}
+
+	if username != "" {
+		var user models.User
+		err := managers.DB.Select("id").Where("username = ?", username).First(&user).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+			return
+		}
+
+		// 用户不存在时返回空列表，不暴露账号是否存在
+		if err == nil {
+			userID = managers.IDToString(user.ID)
+
+			var credentials []models.WebAuthnCredential
+			if err := managers.DB.Select("credential_id").Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+				slog.Error(utils.DBErrorString, "err", err)
+				http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+				return
+			}
+
+			for _, credential := range credentials {
+				allow = append(allow, map[string]string{
+					"type": "public-key",
+					"id":   base64.RawURLEncoding.EncodeToString(credential.CredentialID),
+				})
+			}
+		}
+	}
+
+	challenge, err := models.NewWebAuthnChallenge(r.Context(), managers.WALOGIN, userID)
+	if err != nil {
+		slog.Error(utils.CacheErrorString, "err", err)
+		http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, map[string]interface{}{
+		"challenge":        challenge,
+		"rpId":             models.WebAuthnRPID(),
+		"timeout":          models.WebAuthnChallengeLife.Milliseconds(),
+		"allowCredentials": allow,
+		"userVerification": "required",
+	})
+}
+
+// 完成通行密钥登录，校验签名后签发会话
+func handleWebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	credentialID := decodeWebAuthnField(r, "id")
+	clientDataJSON := decodeWebAuthnField(r, "clientDataJSON")
+	rawAuthData := decodeWebAuthnField(r, "authenticatorData")
+	signature := decodeWebAuthnField(r, "signature")
+	userHandle := r.PostFormValue("userHandle")
+
+	if credentialID == nil || clientDataJSON == nil || rawAuthData == nil || signature == nil {
+		http.Error(w, utils.ParamsWrongString, http.StatusBadRequest)
+		return
+	}
+
+	msg := "Passkey verification failed"
+
+	clientData, err := utils.ParseClientData(clientDataJSON)
+	if err != nil || clientData.Type != "webauthn.get" || !models.WebAuthnOrigin(clientData.Origin) {
+		slog.Error(msg, "reason", "client data", "err", err)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	expected, err := models.TakeWebAuthnChallenge(ctx, managers.WALOGIN, clientData.Challenge)
+	if err != nil {
+		if err == redis.Nil {
+			slog.Error(msg, "reason", "challenge")
+			http.Error(w, msg, http.StatusUnauthorized)
+		} else {
+			slog.Error(utils.CacheErrorString, "err", err)
+			http.Error(w, utils.CacheErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var credential models.WebAuthnCredential
+	if err := managers.DB.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			slog.Error(msg, "reason", "credential")
+			http.Error(w, msg, http.StatusUnauthorized)
+		} else {
+			slog.Error(utils.DBErrorString, "err", err)
+			http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if expected != "" && expected != managers.IDToString(credential.UserID) {
+		slog.Error(msg, "reason", "user mismatch")
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	if userHandle != "" && userHandle != models.WebAuthnUserHandle(credential.UserID) {
+		slog.Error(msg, "reason", "user handle")
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	authData, err := utils.ParseAuthenticatorData(rawAuthData)
+	// 丢失的认证器不能单独完成登录，必须带 UV 标志
+	if err != nil || !authData.CheckRPIDHash(models.WebAuthnRPID()) || !authData.UserVerified() {
+		slog.Error(msg, "reason", "authenticator data", "err", err)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(bytes.Clone(rawAuthData), clientDataHash[:]...)
+	if err := utils.COSEVerify(credential.PublicKey, signed, signature); err != nil {
+		slog.Error(msg, "reason", "signature", "err", err)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	// 签名计数器未递增说明凭据可能被克隆
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		slog.Error(msg, "reason", "sign count", "credential", credential.ID)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	if err := managers.DB.Model(&credential).Updates(map[string]interface{}{
+		"sign_count":   authData.SignCount,
+		"last_used_at": &now,
+	}).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	if err := managers.DB.First(&user, credential.UserID).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	finishLogin(w, r, &user, utils.ParseIP(r), models.LoginMethodWebAuthn)
+}
+
+// 获取当前用户的通行密钥
+func handleListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+
+	var credentials []models.WebAuthnCredential
+	if err := managers.DB.Where("user_id = ?", userID).Order("id").Find(&credentials).Error; err != nil {
+		slog.Error(utils.DBErrorString, "err", err)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	utils.SucessWithData(w, credentials)
+}
+
+// 重命名通行密钥
+func handleRenameWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+	id := r.PostFormValue("id")
+	name := r.PostFormValue("name")
+
+	if id == "" || name == "" {
+		http.Error(w, "Credential ID and name are required", http.StatusBadRequest)
+		return
+	}
+
+	result := managers.DB.Model(&models.WebAuthnCredential{}).Where("id = ? AND user_id = ?", id, userID).Update("name", name)
+	if result.Error != nil {
+		slog.Error(utils.DBErrorString, "err", result.Error)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		http.Error(w, "Credential not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
+
+// 删除通行密钥
+func handleDeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(UserID).(string)
+	id := r.URL.Query().Get("id")
+
+	if id == "" {
+		http.Error(w, "Credential ID is required", http.StatusBadRequest)
+		return
+	}
+
+	result := managers.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		slog.Error(utils.DBErrorString, "err", result.Error)
+		http.Error(w, utils.DBErrorString, http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		http.Error(w, "Credential not found", http.StatusNotFound)
+		return
+	}
+
+	utils.Sucess(w)
+}
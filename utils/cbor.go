@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrCBOR = errors.New("malformed cbor")
+
+// CBORDecode 解码一个 CBOR 数据项，返回剩余未解析的字节。
+// 仅支持 WebAuthn 用到的定长子集：整数统一解码为 int64，
+// 字节串为 []byte，文本为 string，数组为 []interface{}，
+// 映射为 map[interface{}]interface{}。
+func CBORDecode(data []byte) (interface{}, []byte, error) {
+	return cborDecode(data, 0)
+}
+
+func cborDecode(data []byte, depth int) (interface{}, []byte, error) {
+	if len(data) == 0 || depth > 16 {
+		return nil, nil, ErrCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		default:
+			return nil, nil, ErrCBOR
+		}
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(data) >= 1:
+		arg, data = uint64(data[0]), data[1:]
+	case info == 25 && len(data) >= 2:
+		arg, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26 && len(data) >= 4:
+		arg, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27 && len(data) >= 8:
+		arg, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, ErrCBOR
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, ErrCBOR
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, ErrCBOR
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if uint64(len(data)) < arg {
+			return nil, nil, ErrCBOR
+		}
+		if major == 2 {
+			return data[:arg], data[arg:], nil
+		}
+		return string(data[:arg]), data[arg:], nil
+	case 4:
+		if uint64(len(data)) < arg {
+			return nil, nil, ErrCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, rest, err := cborDecode(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+			data = rest
+		}
+		return items, data, nil
+	case 5:
+		if uint64(len(data)) < arg*2 {
+			return nil, nil, ErrCBOR
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, rest, err := cborDecode(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, ErrCBOR
+			}
+			value, rest, err := cborDecode(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+			data = rest
+		}
+		return items, data, nil
+	}
+
+	return nil, nil, ErrCBOR
+}
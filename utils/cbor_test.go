@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCBORDecode(t *testing.T) {
+	// 取自 RFC 8949 附录 A
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"40", []byte{}},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"80", []interface{}{}},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"a0", map[interface{}]interface{}{}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	}
+
+	for _, tt := range tests {
+		raw, _ := hex.DecodeString(tt.hex)
+		got, rest, err := CBORDecode(raw)
+		if err != nil {
+			t.Errorf("CBORDecode(%s) error: %v", tt.hex, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("CBORDecode(%s) left %d bytes", tt.hex, len(rest))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CBORDecode(%s) = %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestCBORDecodeRest(t *testing.T) {
+	raw, _ := hex.DecodeString("0102")
+	item, rest, err := CBORDecode(raw)
+	if err != nil || item != int64(1) || len(rest) != 1 || rest[0] != 0x02 {
+		t.Errorf("CBORDecode = %v, %x, %v, want 1, 02, nil", item, rest, err)
+	}
+}
+
+func TestCBORDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		{"empty", ""},
+		{"truncated uint16", "19 03"},
+		{"truncated byte string", "44010203"},
+		{"truncated text", "64494554"},
+		{"array longer than input", "83 0102"},
+		{"map missing value", "a1 01"},
+		{"map with array key", "a1 80 01"},
+		{"indefinite length", "5f"},
+		{"reserved additional info", "1c"},
+		{"float", "f93c00"},
+		{"tag", "c0 00"},
+		{"uint overflows int64", "1bffffffffffffffff"},
+		{"nesting too deep", "818181818181818181818181818181818181 00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(strings.ReplaceAll(tt.hex, " ", ""))
+			if err != nil {
+				t.Fatalf("bad test hex: %v", err)
+			}
+			if _, _, err := CBORDecode(raw); err != ErrCBOR {
+				t.Errorf("CBORDecode(%s) error = %v, want ErrCBOR", tt.hex, err)
+			}
+		})
+	}
+}
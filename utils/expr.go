@@ -0,0 +1,504 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 策略条件使用的小型表达式语言：
+//
+//	字面量  'text' "text" 42 1.5 true false null ['a', 'b']
+//	路径    subject.id resource.owner_id action
+//	运算    == != < <= > >= in && || ! ( )
+//
+// 数字统一按 float64 比较，路径不存在时取 null，&& || ! 的操作数必须是布尔值
+
+const (
+	exprMaxLength = 2048
+	exprMaxDepth  = 32
+)
+
+var ErrExprSyntax = errors.New("expression syntax error")
+
+// Expr 解析后的表达式，可以并发求值
+type Expr struct {
+	root exprNode
+}
+
+type exprNode interface {
+	eval(env map[string]any) (any, error)
+}
+
+type exprToken struct {
+	kind  byte // i 标识符, s 字符串, n 数字, o 运算符或括号
+	text  string
+	value any
+}
+
+// ParseExpr 解析表达式
+func ParseExpr(source string) (*Expr, error) {
+	if len(source) > exprMaxLength {
+		return nil, fmt.Errorf("%w: expression is too long", ErrExprSyntax)
+	}
+
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrExprSyntax, p.tokens[p.pos].text)
+	}
+
+	return &Expr{root: root}, nil
+}
+
+// Eval 对表达式求值，结果必须是布尔值
+func (e *Expr) Eval(env map[string]any) (bool, error) {
+	value, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %T, want bool", value)
+	}
+	return result, nil
+}
+
+func lexExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(source); {
+		c := source[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'' || c == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(source) && source[j] != c; j++ {
+				if source[j] == '\\' && j+1 < len(source) {
+					j++
+				}
+				text.WriteByte(source[j])
+			}
+			if j >= len(source) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrExprSyntax)
+			}
+			tokens = append(tokens, exprToken{kind: 's', text: source[i : j+1], value: text.String()})
+			i = j + 1
+
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			j := i + 1
+			for j < len(source) && (source[j] >= '0' && source[j] <= '9' || source[j] == '.') {
+				j++
+			}
+			number, err := strconv.ParseFloat(source[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid number %q", ErrExprSyntax, source[i:j])
+			}
+			tokens = append(tokens, exprToken{kind: 'n', text: source[i:j], value: number})
+			i = j
+
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(source) && (source[j] == '_' || source[j] == '.' ||
+				source[j] >= 'a' && source[j] <= 'z' || source[j] >= 'A' && source[j] <= 'Z' || source[j] >= '0' && source[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: 'i', text: source[i:j]})
+			i = j
+
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w: unexpected character %q", ErrExprSyntax, c)
+			}
+			tokens = append(tokens, exprToken{kind: 'o', text: op})
+			i += len(op)
+		}
+	}
+
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind != 's' && p.tokens[p.pos].text == text
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.peek(text) {
+		return fmt.Errorf("%w: expected %q", ErrExprSyntax, text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseOr(depth int) (exprNode, error) {
+	if depth > exprMaxDepth {
+		return nil, fmt.Errorf("%w: expression is nested too deeply", ErrExprSyntax)
+	}
+
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.pos++
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd(depth int) (exprNode, error) {
+	left, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.pos++
+		right, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot(depth int) (exprNode, error) {
+	if p.peek("!") {
+		p.pos++
+		if depth > exprMaxDepth {
+			return nil, fmt.Errorf("%w: expression is nested too deeply", ErrExprSyntax)
+		}
+		operand, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *exprParser) parseCompare(depth int) (exprNode, error) {
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.peek(op) {
+			p.pos++
+			right, err := p.parseTerm(depth)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm(depth int) (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrExprSyntax)
+	}
+
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case 's', 'n':
+		return &literalNode{value: token.value}, nil
+
+	case 'i':
+		switch token.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		case "in":
+			return nil, fmt.Errorf("%w: unexpected \"in\"", ErrExprSyntax)
+		}
+		parts := strings.Split(token.text, ".")
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("%w: invalid path %q", ErrExprSyntax, token.text)
+			}
+		}
+		return &pathNode{parts: parts}, nil
+	}
+
+	switch token.text {
+	case "(":
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+
+	case "[":
+		list := &listNode{}
+		for !p.peek("]") {
+			if len(list.items) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			item, err := p.parseTerm(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+		}
+		p.pos++
+		return list, nil
+	}
+
+	return nil, fmt.Errorf("%w: unexpected %q", ErrExprSyntax, token.text)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(env map[string]any) (any, error) {
+	return n.value, nil
+}
+
+type pathNode struct {
+	parts []string
+}
+
+func (n *pathNode) eval(env map[string]any) (any, error) {
+	var current any = env
+	for _, part := range n.parts {
+		switch node := current.(type) {
+		case map[string]any:
+			current = node[part]
+		case map[string]string:
+			value, ok := node[part]
+			if !ok {
+				return nil, nil
+			}
+			current = value
+		default:
+			return nil, nil
+		}
+	}
+	return normalizeExprValue(current), nil
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(env map[string]any) (any, error) {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(env map[string]any) (any, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operand of ! must be bool, got %T", value)
+	}
+	return !b, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env map[string]any) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逻辑运算短路求值
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of %s must be bool, got %T", n.op, left)
+		}
+		if n.op == "&&" && !l || n.op == "||" && l {
+			return l, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operand of %s must be bool, got %T", n.op, right)
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "in":
+		list, ok := right.([]any)
+		if !ok {
+			// 右侧为 null（例如属性不存在）时视为空列表
+			if right == nil {
+				return false, nil
+			}
+			return nil, fmt.Errorf("right operand of in must be a list, got %T", right)
+		}
+		for _, item := range list {
+			if exprEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	// 大小比较只支持同为数字或同为字符串
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, nil
+		}
+		cmp = compareOrdered(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, nil
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return false, nil
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func compareOrdered(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func exprEqual(a any, b any) bool {
+	switch a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	}
+	return false
+}
+
+// normalizeExprValue 把属性中的整数统一为 float64，字符串切片转为 []any
+func normalizeExprValue(value any) any {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case *uint:
+		if v == nil {
+			return nil
+		}
+		return float64(*v)
+	case []string:
+		list := make([]any, len(v))
+		for i, s := range v {
+			list[i] = s
+		}
+		return list
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = normalizeExprValue(item)
+		}
+		return list
+	}
+	return value
+}
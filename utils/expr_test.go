@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	owner := uint(7)
+	env := map[string]any{
+		"action": "documents:read",
+		"subject": map[string]any{
+			"id":     "u1",
+			"level":  3,
+			"groups": []string{"staff", "ops"},
+		},
+		"resource": map[string]any{
+			"owner_id": "u1",
+			"size":     int64(2048),
+			"org_id":   &owner,
+			"labels":   map[string]string{"tier": "gold"},
+		},
+	}
+
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"!false", true},
+		{"!!true", true},
+		{"subject.id == resource.owner_id", true},
+		{"subject.id != resource.owner_id", false},
+		{`action == "documents:read"`, true},
+		{"action == 'documents:write'", false},
+		{"subject.level >= 3", true},
+		{"subject.level > 3", false},
+		{"subject.level < 3.5", true},
+		{"resource.size <= 2048", true},
+		{"resource.size == 2048", true},
+		{"resource.org_id == 7", true},
+		{"subject.level > -1", true},
+		{"'b' > 'a'", true},
+		{"'a' < 1", false},
+		{"'staff' in subject.groups", true},
+		{"'admin' in subject.groups", false},
+		{"resource.labels.tier in ['gold', 'silver']", true},
+		{"3 in [1, 2, 3]", true},
+		{"[] == []", false},
+		{"'x' in resource.missing", false},
+		{"resource.missing == null", true},
+		{"resource.labels.missing == null", true},
+		{"subject.id.deeper == null", true},
+		{"subject.level == '3'", false},
+		{"true && false || true", true},
+		{"true && (false || true)", true},
+		{"false && (false || true)", false},
+		{"!(subject.level > 5) && 'ops' in subject.groups", true},
+		{"'say \\'hi\\'' == \"say 'hi'\"", true},
+		// 短路求值时右侧的类型错误不会暴露
+		{"false && 1", false},
+		{"true || 'x'", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			expr, err := ParseExpr(tt.source)
+			if err != nil {
+				t.Fatalf("ParseExpr error: %v", err)
+			}
+			got, err := expr.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	env := map[string]any{"subject": map[string]any{"id": "u1"}}
+
+	tests := []string{
+		"subject.id",
+		"1",
+		"null",
+		"!subject.id",
+		"subject.id && true",
+		"true && subject.id",
+		"'a' in 'abc'",
+	}
+
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			expr, err := ParseExpr(source)
+			if err != nil {
+				t.Fatalf("ParseExpr error: %v", err)
+			}
+			if _, err := expr.Eval(env); err == nil {
+				t.Error("Eval accepted a non-boolean operand")
+			}
+		})
+	}
+}
+
+func TestParseExprMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"empty", ""},
+		{"only spaces", "   "},
+		{"unterminated string", "'abc"},
+		{"unterminated double quote", `action == "read`},
+		{"unexpected character", "a = b"},
+		{"dangling operator", "a =="},
+		{"dangling and", "a &&"},
+		{"two terms", "a b"},
+		{"unclosed paren", "(a == b"},
+		{"extra close paren", "a == b)"},
+		{"unclosed list", "a in ['x'"},
+		{"list without comma", "a in ['x' 'y']"},
+		{"leading comma in list", "a in [, 'x']"},
+		{"chained comparison", "1 < 2 < 3"},
+		{"bare in", "in"},
+		{"invalid number", "1.2.3 == 1"},
+		{"empty path segment", "subject..id == 1"},
+		{"trailing dot", "subject. == 1"},
+		{"nested too deeply", strings.Repeat("(", 40) + "true" + strings.Repeat(")", 40)},
+		{"negated too deeply", strings.Repeat("!", 40) + "true"},
+		{"too long", strings.Repeat("a", exprMaxLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseExpr(tt.source); !errors.Is(err, ErrExprSyntax) {
+				t.Errorf("ParseExpr(%q) error = %v, want ErrExprSyntax", tt.source, err)
+			}
+		})
+	}
+}
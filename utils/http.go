@@ -42,6 +42,13 @@ func SucessWithData(w http.ResponseWriter, data interface{}) error {
 	return json.NewEncoder(w).Encode(responseData{Code: 0, Data: data})
 }
 
+// FailWithData 以 JSON 返回带有详细信息的错误
+func FailWithData(w http.ResponseWriter, status int, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(responseData{Code: status, Data: data})
+}
+
 type GzipResponseWriter struct {
 	http.ResponseWriter
 	gz *gzip.Writer
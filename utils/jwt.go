@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgEdDSA = "EdDSA"
+	JWTAlgES256 = "ES256"
+	JWTAlgRS256 = "RS256"
+
+	// JWTTypeAccess RFC 9068 访问令牌的 typ，用来和 ID Token 区分
+	JWTTypeAccess = "at+jwt"
+)
+
+var (
+	ErrJWTMalformed = errors.New("malformed jwt")
+	ErrJWTSignature = errors.New("invalid jwt signature")
+	ErrJWTExpired   = errors.New("jwt has expired")
+	ErrJWTKey       = errors.New("unsupported jwt key")
+)
+
+// JWTHeader JOSE 头部
+type JWTHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTAlgorithm 根据私钥类型返回对应的 JWS 算法
+func JWTAlgorithm(key crypto.Signer) (string, error) {
+	switch pub := key.Public().(type) {
+	case ed25519.PublicKey:
+		return JWTAlgEdDSA, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve.Params().BitSize == 256 {
+			return JWTAlgES256, nil
+		}
+	}
+	return "", ErrJWTKey
+}
+
+// JWTKeyID 以公钥指纹作为 kid
+func JWTKeyID(pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// JWTSign 签发紧凑格式的 JWT
+func JWTSign(key crypto.Signer, kid string, typ string, claims map[string]interface{}) (string, error) {
+	alg, err := JWTAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(JWTHeader{Alg: alg, Typ: typ, Kid: kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch alg {
+	case JWTAlgEdDSA:
+		signature, err = key.Sign(rand.Reader, []byte(signing), crypto.Hash(0))
+	case JWTAlgES256:
+		digest := sha256.Sum256([]byte(signing))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err == nil {
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return signing + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// JWTVerify 校验签名和 exp / nbf，返回头部和声明，typ 等头部字段由调用方检查
+func JWTVerify(token string, keys func(kid string) crypto.PublicKey) (*JWTHeader, map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	var header JWTHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	pub := keys(header.Kid)
+	if pub == nil {
+		return nil, nil, ErrJWTSignature
+	}
+
+	signing := []byte(parts[0] + "." + parts[1])
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		if header.Alg != JWTAlgEdDSA || !ed25519.Verify(key, signing, signature) {
+			return nil, nil, ErrJWTSignature
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != JWTAlgES256 || len(signature) != 64 {
+			return nil, nil, ErrJWTSignature
+		}
+		digest := sha256.Sum256(signing)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return nil, nil, ErrJWTSignature
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signing)
+		if header.Alg != JWTAlgRS256 || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, nil, ErrJWTSignature
+		}
+	default:
+		return nil, nil, ErrJWTKey
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, nil, ErrJWTMalformed
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok || now >= exp {
+		return nil, nil, ErrJWTExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, nil, ErrJWTExpired
+	}
+
+	return &header, claims, nil
+}
+
+// JWK 把公钥导出为 JWK，用于发布 JWKS
+func JWK(pub crypto.PublicKey, kid string) map[string]string {
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(key),
+			"alg": JWTAlgEdDSA,
+			"use": "sig",
+			"kid": kid,
+		}
+	case *ecdsa.PublicKey:
+		raw, err := key.Bytes()
+		if err != nil {
+			return nil
+		}
+		return map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(raw[1:33]),
+			"y":   base64.RawURLEncoding.EncodeToString(raw[33:]),
+			"alg": JWTAlgES256,
+			"use": "sig",
+			"kid": kid,
+		}
+	}
+	return nil
+}
+
+// ParseJWK 把 JWK 解析为公钥，用于校验外部签发的令牌
+func ParseJWK(jwk map[string]interface{}) (crypto.PublicKey, error) {
+	field := func(name string) []byte {
+		value, _ := jwk[name].(string)
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+
+	kty, _ := jwk["kty"].(string)
+	crv, _ := jwk["crv"].(string)
+
+	switch {
+	case kty == "RSA":
+		n, e := field("n"), field("e")
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrJWTKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case kty == "EC" && crv == "P-256":
+		x, y := field("x"), field("y")
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrJWTKey
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, ErrJWTKey
+		}
+		return key, nil
+	case kty == "OKP" && crv == "Ed25519":
+		x := field("x")
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrJWTKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, ErrJWTKey
+}
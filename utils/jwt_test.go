@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func singleKey(pub crypto.PublicKey) func(string) crypto.PublicKey {
+	return func(string) crypto.PublicKey { return pub }
+}
+
+// rs256Token 按 RS256 签发，JWTSign 不支持 RSA，只有外部签发的令牌会用到
+func rs256Token(t *testing.T, key *rsa.PrivateKey, claims string) string {
+	signing := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	digest := sha256.Sum256([]byte(signing))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTSignVerify(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+	}{
+		{"EdDSA", edKey, JWTAlgEdDSA},
+		{"ES256", ecKey, JWTAlgES256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kid := JWTKeyID(tt.key.Public())
+			claims := map[string]interface{}{"sub": "user-id", "exp": float64(time.Now().Add(time.Minute).Unix())}
+
+			token, err := JWTSign(tt.key, kid, JWTTypeAccess, claims)
+			if err != nil {
+				t.Fatalf("JWTSign error: %v", err)
+			}
+
+			header, got, err := JWTVerify(token, func(k string) crypto.PublicKey {
+				if k != kid {
+					return nil
+				}
+				return tt.key.Public()
+			})
+			if err != nil {
+				t.Fatalf("JWTVerify error: %v", err)
+			}
+			if *header != (JWTHeader{Alg: tt.alg, Typ: JWTTypeAccess, Kid: kid}) {
+				t.Errorf("header = %+v", *header)
+			}
+			if !reflect.DeepEqual(got, claims) {
+				t.Errorf("claims = %v, want %v", got, claims)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyRejects(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pub := key.Public()
+
+	now := time.Now().Unix()
+	sign := func(claims map[string]interface{}) string {
+		token, err := JWTSign(key, "", "", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := sign(map[string]interface{}{"exp": now + 60})
+	parts := strings.Split(valid, ".")
+	// 声明被篡改后签名不再匹配
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"exp":9999999999}`)) + "." + parts[2]
+	// 头部声称 ES256，但密钥是 Ed25519
+	algSwap := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + parts[1] + "." + parts[2]
+
+	tests := []struct {
+		name  string
+		token string
+		keys  func(string) crypto.PublicKey
+		err   error
+	}{
+		{"expired", sign(map[string]interface{}{"exp": now - 1}), singleKey(pub), ErrJWTExpired},
+		{"no exp", sign(map[string]interface{}{"sub": "x"}), singleKey(pub), ErrJWTExpired},
+		{"not yet valid", sign(map[string]interface{}{"exp": now + 60, "nbf": now + 30}), singleKey(pub), ErrJWTExpired},
+		{"wrong key", valid, singleKey(otherPub), ErrJWTSignature},
+		{"unknown kid", valid, singleKey(nil), ErrJWTSignature},
+		{"key of another type", valid, singleKey(&ecKey.PublicKey), ErrJWTSignature},
+		{"tampered claims", tampered, singleKey(pub), ErrJWTSignature},
+		{"algorithm mismatch", algSwap, singleKey(pub), ErrJWTSignature},
+		{"two parts", parts[0] + "." + parts[1], singleKey(pub), ErrJWTMalformed},
+		{"header not base64", "!." + parts[1] + "." + parts[2], singleKey(pub), ErrJWTMalformed},
+		{"header not json", "e30x." + parts[1] + "." + parts[2], singleKey(pub), ErrJWTMalformed},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!", singleKey(pub), ErrJWTMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := JWTVerify(tt.token, tt.keys); err != tt.err {
+				t.Errorf("JWTVerify error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := rs256Token(t, key, `{"sub":"external","exp":9999999999}`)
+	if _, claims, err := JWTVerify(token, singleKey(&key.PublicKey)); err != nil || claims["sub"] != "external" {
+		t.Errorf("JWTVerify = %v, %v", claims, err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, _, err := JWTVerify(token, singleKey(&other.PublicKey)); err != ErrJWTSignature {
+		t.Errorf("JWTVerify with another RSA key error = %v, want ErrJWTSignature", err)
+	}
+}
+
+func TestJWTAlgorithm(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		alg  string
+		err  error
+	}{
+		{"Ed25519", edKey, JWTAlgEdDSA, nil},
+		{"P-256", p256, JWTAlgES256, nil},
+		{"P-384", p384, "", ErrJWTKey},
+		{"RSA", rsaKey, "", ErrJWTKey},
+	}
+
+	for _, tt := range tests {
+		if alg, err := JWTAlgorithm(tt.key); alg != tt.alg || err != tt.err {
+			t.Errorf("JWTAlgorithm(%s) = %q, %v, want %q, %v", tt.name, alg, err, tt.alg, tt.err)
+		}
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	tests := []struct {
+		name string
+		pub  crypto.PublicKey
+	}{
+		{"Ed25519", edPub},
+		{"P-256", &ecKey.PublicKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk := map[string]interface{}{}
+			for k, v := range JWK(tt.pub, "kid") {
+				jwk[k] = v
+			}
+
+			got, err := ParseJWK(jwk)
+			if err != nil {
+				t.Fatalf("ParseJWK error: %v", err)
+			}
+			if !got.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.pub) {
+				t.Error("ParseJWK returned a different key")
+			}
+		})
+	}
+}
+
+func TestParseJWKRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  map[string]interface{}
+	}{
+		{"empty", map[string]interface{}{}},
+		{"unknown kty", map[string]interface{}{"kty": "oct", "k": "AAAA"}},
+		{"EC wrong curve", map[string]interface{}{"kty": "EC", "crv": "P-384", "x": "AAAA", "y": "AAAA"}},
+		{"EC short coordinates", map[string]interface{}{"kty": "EC", "crv": "P-256", "x": "AAAA", "y": "AAAA"}},
+		{"EC point not on curve", map[string]interface{}{"kty": "EC", "crv": "P-256", "x": strings.Repeat("A", 43), "y": strings.Repeat("A", 43)}},
+		{"Ed25519 short key", map[string]interface{}{"kty": "OKP", "crv": "Ed25519", "x": "AAAA"}},
+		{"RSA small modulus", map[string]interface{}{"kty": "RSA", "n": strings.Repeat("A", 100), "e": "AQAB"}},
+		{"x not a string", map[string]interface{}{"kty": "OKP", "crv": "Ed25519", "x": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJWK(tt.jwk); err != ErrJWTKey {
+				t.Errorf("ParseJWK error = %v, want ErrJWTKey", err)
+			}
+		})
+	}
+}
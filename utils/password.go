@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2KeyLength = 32
+
+var ErrPasswordHash = errors.New("malformed password hash")
+
+// Argon2Params Argon2id 参数，Memory 单位为 KiB
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 2}
+
+// HashPassword 以 PHC 字符串格式输出 Argon2id 哈希，算法和参数随哈希一起保存：
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string, params Argon2Params) string {
+	salt := RandomBytes(16)
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// VerifyPassword 常量时间校验 PHC 格式的哈希。
+// 哈希的参数与 params 不一致时 rehash 为 true，调用方应在校验成功后重新计算哈希。
+func VerifyPassword(password string, encoded string, params Argon2Params) (ok bool, rehash bool, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return false, false, ErrPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrPasswordHash
+	}
+
+	var stored Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &stored.Memory, &stored.Time, &stored.Threads); err != nil {
+		return false, false, ErrPasswordHash
+	}
+	if stored.Memory == 0 || stored.Time == 0 || stored.Threads == 0 {
+		return false, false, ErrPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false, ErrPasswordHash
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, stored.Time, stored.Memory, stored.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, stored != params || len(key) != argon2KeyLength, nil
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// 测试用小参数，避免每个用例都分配 64 MiB
+var testArgon2Params = Argon2Params{Memory: 1024, Time: 1, Threads: 1}
+
+func TestHashPasswordFormat(t *testing.T) {
+	encoded := HashPassword("correct horse", testArgon2Params)
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("HashPassword = %s", encoded)
+	}
+	if HashPassword("correct horse", testArgon2Params) == encoded {
+		t.Error("HashPassword reused the salt")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	encoded := HashPassword("correct horse", testArgon2Params)
+	stronger := Argon2Params{Memory: 2048, Time: 1, Threads: 1}
+	// 早期 16 字节的哈希同样能校验，但需要升级
+	salt := []byte("saltsaltsaltsalt")
+	shortKey := "$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("correct horse"), salt, 1, 1024, 1, 16))
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		params   Argon2Params
+		ok       bool
+		rehash   bool
+	}{
+		{"correct password", "correct horse", encoded, testArgon2Params, true, false},
+		{"wrong password", "correct horsf", encoded, testArgon2Params, false, false},
+		{"empty password", "", encoded, testArgon2Params, false, false},
+		{"parameters changed", "correct horse", encoded, stronger, true, true},
+		{"wrong password with parameters changed", "battery staple", encoded, stronger, false, false},
+		{"short key", "correct horse", shortKey, testArgon2Params, true, true},
+		{"short key wrong password", "battery staple", shortKey, testArgon2Params, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := VerifyPassword(tt.password, tt.encoded, tt.params)
+			if err != nil {
+				t.Fatalf("VerifyPassword error: %v", err)
+			}
+			if ok != tt.ok || rehash != tt.rehash {
+				t.Errorf("VerifyPassword = %v, %v, want %v, %v", ok, rehash, tt.ok, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordMalformed(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "aGFzaGhhc2hoYXNoaGFzaGhhc2hoYXNoaGFzaGhhc2g"
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"legacy PBKDF2 bytes", "not-a-phc-string"},
+		{"argon2i", "$argon2i$v=19$m=1024,t=1,p=1$" + salt + "$" + key},
+		{"old version", "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key},
+		{"missing version", "$argon2id$m=1024,t=1,p=1$" + salt + "$" + key},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key},
+		{"zero memory", "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key},
+		{"zero time", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{"salt not base64", "$argon2id$v=19$m=1024,t=1,p=1$!!$" + key},
+		{"empty key", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+		{"extra field", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + key + "$x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := VerifyPassword("password", tt.encoded, testArgon2Params)
+			if err != ErrPasswordHash || ok || rehash {
+				t.Errorf("VerifyPassword = %v, %v, %v, want ErrPasswordHash", ok, rehash, err)
+			}
+		})
+	}
+}
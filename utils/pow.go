@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"strconv"
+)
+
+// PoWLeadingZeros 计算 SHA-256(challenge + ":" + solution) 开头连续为 0 的比特数
+func PoWLeadingZeros(challenge string, solution string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+
+	zeros := 0
+	for _, b := range sum {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// PoWSolve 暴力求解工作量证明，供命令行客户端和联调使用
+func PoWSolve(challenge string, difficulty int) string {
+	buf := make([]byte, 0, 20)
+	for n := uint64(0); ; n++ {
+		buf = strconv.AppendUint(buf[:0], n, 10)
+		if PoWLeadingZeros(challenge, string(buf)) >= difficulty {
+			return string(buf)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// leadingZeroBits 逐位数出前导零，用来核对按字节计算的结果
+func leadingZeroBits(sum [32]byte) int {
+	zeros := 0
+	for _, b := range sum {
+		for i := 7; i >= 0; i-- {
+			if b>>i&1 != 0 {
+				return zeros
+			}
+			zeros++
+		}
+	}
+	return zeros
+}
+
+func TestPoWLeadingZeros(t *testing.T) {
+	tests := []struct {
+		challenge string
+		solution  string
+	}{
+		{"", ""},
+		{"challenge", "0"},
+		{"challenge", "1"},
+		{"challenge", "12345"},
+		{"another", "999999"},
+	}
+
+	for _, tt := range tests {
+		sum := sha256.Sum256([]byte(tt.challenge + ":" + tt.solution))
+		if got, want := PoWLeadingZeros(tt.challenge, tt.solution), leadingZeroBits(sum); got != want {
+			t.Errorf("PoWLeadingZeros(%q, %q) = %d, want %d (%s)", tt.challenge, tt.solution, got, want, hex.EncodeToString(sum[:]))
+		}
+	}
+}
+
+func TestPoWSolve(t *testing.T) {
+	tests := []struct {
+		challenge  string
+		difficulty int
+	}{
+		{"challenge", 0},
+		{"challenge", 1},
+		{"challenge", 8},
+		{"another", 12},
+		{"yet-another", 16},
+	}
+
+	for _, tt := range tests {
+		solution := PoWSolve(tt.challenge, tt.difficulty)
+		if got := PoWLeadingZeros(tt.challenge, solution); got < tt.difficulty {
+			t.Errorf("PoWSolve(%q, %d) = %s with %d leading zeros", tt.challenge, tt.difficulty, solution, got)
+		}
+	}
+}
@@ -1,44 +1,44 @@
 package utils
 
 import (
-	"bytes"
+	"crypto/rand"
 	"encoding/base64"
-	"encoding/binary"
-	"math/rand"
 )
 
-func RandomBytes(len int) []byte {
-	realLen := len / 4
-	data := make([]uint32, realLen)
-	for i := 0; i < realLen; i++ {
-		data[i] = rand.Uint32()
-	}
+const randomAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 
-	bytesBuffer := bytes.NewBuffer([]byte{})
-
-	binary.Write(bytesBuffer, binary.BigEndian, data)
-	return bytesBuffer.Bytes()
+// RandomBytes 生成密码学安全的随机字节，令牌、密钥、盐都依赖它
+func RandomBytes(len int) []byte {
+	data := make([]byte, len)
+	// crypto/rand.Read 不会返回错误，系统随机源不可用时直接终止进程
+	rand.Read(data)
+	return data
 }
 
 func RandomURLBase64(len int) string {
 	return base64.URLEncoding.EncodeToString(RandomBytes(len))
 }
 
-func RandomString(len int) string {
-	result := make([]byte, len)
-	var base int
-	for i := 0; i < len; i++ {
-		num := rand.Intn(62)
-		if base < 10 {
-			base = 48
-		} else if base < 36 {
-			base = 65 - 10
-		} else {
-			base = 97 - 36
-		}
-
-		result[i] = byte(base + num)
+// RandomString 生成由数字和大小写字母组成的随机串，拒绝采样保证每个字符均匀分布
+func RandomString(length int) string {
+	if length <= 0 {
+		return ""
 	}
 
-	return string(result)
+	result := make([]byte, 0, length)
+	buf := make([]byte, length)
+
+	for {
+		rand.Read(buf)
+		for _, b := range buf {
+			// 62*4 = 248，超出部分丢弃以免取模偏差
+			if b >= 248 {
+				continue
+			}
+			result = append(result, randomAlphabet[b%62])
+			if len(result) == length {
+				return string(result)
+			}
+		}
+	}
 }
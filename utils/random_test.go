@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRandomString(t *testing.T) {
+	tests := []struct {
+		length int
+		want   int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{6, 6},
+		{300, 300},
+	}
+
+	for _, tt := range tests {
+		s := RandomString(tt.length)
+		if len(s) != tt.want {
+			t.Errorf("RandomString(%d) length = %d, want %d", tt.length, len(s), tt.want)
+		}
+		for _, c := range s {
+			if !strings.ContainsRune(randomAlphabet, c) {
+				t.Errorf("RandomString(%d) contains %q", tt.length, c)
+			}
+		}
+	}
+}
+
+func TestRandomBytes(t *testing.T) {
+	a, b := RandomBytes(32), RandomBytes(32)
+	if len(a) != 32 || len(b) != 32 {
+		t.Fatalf("RandomBytes length = %d, %d, want 32", len(a), len(b))
+	}
+	if string(a) == string(b) {
+		t.Error("RandomBytes returned the same bytes twice")
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignTokenRoundTrip(t *testing.T) {
+	SetSignSecret("sign-test-secret")
+
+	tests := []struct {
+		name   string
+		fields []string
+	}{
+		{"no fields", []string{}},
+		{"one field", []string{"user-id"}},
+		{"several fields", []string{"user-id", "reset", "a@example.com"}},
+		{"empty field", []string{"", "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyToken(SignToken(time.Minute, tt.fields...))
+			if err != nil {
+				t.Fatalf("VerifyToken error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("VerifyToken = %q, want %q", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	SetSignSecret("sign-test-secret")
+	token := SignToken(time.Minute, "user-id")
+	payload, signature, _ := strings.Cut(token, ".")
+
+	SetSignSecret("another-secret")
+	otherKey := SignToken(time.Minute, "user-id")
+	SetSignSecret("sign-test-secret")
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"expired", SignToken(-time.Minute, "user-id"), ErrExpired},
+		{"no separator", payload + signature, ErrSignature},
+		{"empty", "", ErrSignature},
+		{"tampered payload", "x" + payload[1:] + "." + signature, ErrSignature},
+		{"tampered signature", payload + "." + signature[:len(signature)-1], ErrSignature},
+		{"other secret", otherKey, ErrSignature},
+		{"payload not base64", "!!!." + signPayload("!!!"), ErrSignature},
+		{"no expiration", "dXNlcg." + signPayload("dXNlcg"), ErrSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyToken(tt.token); err != tt.err {
+				t.Errorf("VerifyToken error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 给出的是 8 位验证码，这里取后 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, uint64(tt.unix)/TOTPPeriod)
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPCodeHOTP(t *testing.T) {
+	// RFC 4226 附录 D，同一密钥按计数器计算
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		got, err := TOTPCode(strings.ToLower(rfcSecret), uint64(counter))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) error: %v", counter, err)
+		}
+		if got != code {
+			t.Errorf("TOTPCode(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTPCodeInvalidSecret(t *testing.T) {
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted an invalid secret")
+	}
+}
+
+func TestTOTPValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := uint64(now.Unix()) / TOTPPeriod
+
+	previous, _ := TOTPCode(rfcSecret, current-1)
+	next, _ := TOTPCode(rfcSecret, current+1)
+	stale, _ := TOTPCode(rfcSecret, current-2)
+
+	tests := []struct {
+		name    string
+		code    string
+		skew    int
+		ok      bool
+		counter uint64
+	}{
+		{"current step", "050471", 1, true, current},
+		{"previous step within skew", previous, 1, true, current - 1},
+		{"next step within skew", next, 1, true, current + 1},
+		{"outside skew", stale, 1, false, 0},
+		{"no skew", previous, 0, false, 0},
+		{"wrong code", "000000", 1, false, 0},
+		{"too short", "50471", 1, false, 0},
+		{"too long", "0050471", 1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := TOTPValidate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.ok || counter != tt.counter {
+				t.Errorf("TOTPValidate(%q) = %d, %v, want %d, %v", tt.code, counter, ok, tt.counter, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTOTPSecretRoundTrip(t *testing.T) {
+	secret := TOTPSecret()
+	if len(secret) != 32 {
+		t.Fatalf("TOTPSecret length = %d, want 32", len(secret))
+	}
+
+	code, err := TOTPCode(secret, 1)
+	if err != nil {
+		t.Fatalf("TOTPCode error: %v", err)
+	}
+	if _, ok := TOTPValidate(secret, code, time.Unix(TOTPPeriod, 0), 0); !ok {
+		t.Error("TOTPValidate rejected a freshly generated code")
+	}
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	AuthFlagUserPresent  = 0x01
+	AuthFlagUserVerified = 0x04
+	AuthFlagAttested     = 0x40
+	AuthFlagExtensions   = 0x80
+)
+
+// COSE 算法标识
+const (
+	COSEAlgES256 = -7
+	COSEAlgEdDSA = -8
+)
+
+var (
+	ErrWebAuthnData      = errors.New("malformed webauthn data")
+	ErrWebAuthnKey       = errors.New("unsupported credential public key")
+	ErrWebAuthnSignature = errors.New("invalid webauthn signature")
+)
+
+type ClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// ParseClientData 解析 clientDataJSON
+func ParseClientData(raw []byte) (*ClientData, error) {
+	var data ClientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, ErrWebAuthnData
+	}
+	return &data, nil
+}
+
+// ParseAttestationObject 从 attestationObject 中取出 fmt 和 authData。
+// 不校验证明声明，凭据按 "none" 证明处理。
+func ParseAttestationObject(raw []byte) (string, []byte, error) {
+	item, _, err := CBORDecode(raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	object, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return "", nil, ErrWebAuthnData
+	}
+
+	format, _ := object["fmt"].(string)
+	authData, ok := object["authData"].([]byte)
+	if !ok {
+		return "", nil, ErrWebAuthnData
+	}
+
+	return format, authData, nil
+}
+
+// ParseAuthenticatorData 解析 authenticatorData，带 AT 标志时同时解析凭据 ID 和公钥
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, ErrWebAuthnData
+	}
+
+	data := AuthenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if data.Flags&AuthFlagAttested == 0 {
+		return &data, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, ErrWebAuthnData
+	}
+
+	data.AAGUID = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, ErrWebAuthnData
+	}
+
+	data.CredentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	_, after, err := CBORDecode(rest)
+	if err != nil {
+		return nil, err
+	}
+	data.PublicKey = rest[:len(rest)-len(after)]
+
+	return &data, nil
+}
+
+// CheckRPIDHash 校验 authenticatorData 中的 RP ID 哈希
+func (data *AuthenticatorData) CheckRPIDHash(rpID string) bool {
+	sum := sha256.Sum256([]byte(rpID))
+	return bytes.Equal(data.RPIDHash, sum[:])
+}
+
+// UserVerified 用户在场并且经过验证（UP 和 UV 标志都已设置）
+func (data *AuthenticatorData) UserVerified() bool {
+	return data.Flags&AuthFlagUserPresent != 0 && data.Flags&AuthFlagUserVerified != 0
+}
+
+// COSEAlgorithm 返回 COSE 公钥声明的算法，并确认是受支持的类型
+func COSEAlgorithm(coseKey []byte) (int64, error) {
+	key, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return 0, err
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case COSEAlgES256:
+		_, err = coseECDSAKey(key)
+	case COSEAlgEdDSA:
+		_, err = coseEd25519Key(key)
+	default:
+		err = ErrWebAuthnKey
+	}
+
+	return alg, err
+}
+
+// COSEVerify 使用 COSE 公钥校验签名
+func COSEVerify(coseKey []byte, data []byte, signature []byte) error {
+	key, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case COSEAlgES256:
+		pub, err := coseECDSAKey(key)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return ErrWebAuthnSignature
+		}
+	case COSEAlgEdDSA:
+		pub, err := coseEd25519Key(key)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, data, signature) {
+			return ErrWebAuthnSignature
+		}
+	default:
+		return ErrWebAuthnKey
+	}
+
+	return nil
+}
+
+func parseCOSEKey(raw []byte) (map[interface{}]interface{}, error) {
+	item, _, err := CBORDecode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnKey
+	}
+
+	return key, nil
+}
+
+func coseECDSAKey(key map[interface{}]interface{}) (*ecdsa.PublicKey, error) {
+	kty, _ := key[int64(1)].(int64)
+	crv, _ := key[int64(-1)].(int64)
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+
+	if kty != 2 || crv != 1 || len(x) != 32 || len(y) != 32 {
+		return nil, ErrWebAuthnKey
+	}
+
+	pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, ErrWebAuthnKey
+	}
+
+	return pub, nil
+}
+
+func coseEd25519Key(key map[interface{}]interface{}) (ed25519.PublicKey, error) {
+	kty, _ := key[int64(1)].(int64)
+	crv, _ := key[int64(-1)].(int64)
+	x, _ := key[int64(-2)].([]byte)
+
+	if kty != 1 || crv != 6 || len(x) != ed25519.PublicKeySize {
+		return nil, ErrWebAuthnKey
+	}
+
+	return ed25519.PublicKey(x), nil
+}
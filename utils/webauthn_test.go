@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// cborBytes 编码长度小于 256 的 CBOR 字节串
+func cborBytes(b []byte) []byte {
+	if len(b) < 24 {
+		return append([]byte{0x40 | byte(len(b))}, b...)
+	}
+	return append([]byte{0x58, byte(len(b))}, b...)
+}
+
+func ed25519COSEKey(pub ed25519.PublicKey) []byte {
+	// {1: 1 (OKP), 3: -8 (EdDSA), -1: 6 (Ed25519), -2: x}
+	key := []byte{0xa4, 0x01, 0x01, 0x03, 0x27, 0x20, 0x06, 0x21}
+	return append(key, cborBytes(pub)...)
+}
+
+func es256COSEKey(pub *ecdsa.PublicKey) []byte {
+	raw, _ := pub.Bytes()
+	// {1: 2 (EC2), 3: -7 (ES256), -1: 1 (P-256), -2: x, -3: y}
+	key := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21}
+	key = append(key, cborBytes(raw[1:33])...)
+	key = append(key, 0x22)
+	return append(key, cborBytes(raw[33:])...)
+}
+
+func authenticatorData(rpID string, flags byte, count uint32, credentialID []byte, coseKey []byte) []byte {
+	sum := sha256.Sum256([]byte(rpID))
+	data := append(sum[:], flags)
+	data = binary.BigEndian.AppendUint32(data, count)
+	if flags&AuthFlagAttested == 0 {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(credentialID)))
+	data = append(data, credentialID...)
+	return append(data, coseKey...)
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	coseKey := ed25519COSEKey(pub)
+	credentialID := []byte("credential-id")
+
+	attested := authenticatorData("example.com", AuthFlagUserPresent|AuthFlagUserVerified|AuthFlagAttested, 7, credentialID, coseKey)
+	// 扩展数据跟在公钥后面，不能算进公钥
+	withExtensions := append(authenticatorData("example.com", AuthFlagUserPresent|AuthFlagAttested|AuthFlagExtensions, 1, credentialID, coseKey), 0xa0)
+
+	tests := []struct {
+		name         string
+		raw          []byte
+		err          bool
+		flags        byte
+		count        uint32
+		credentialID string
+		publicKey    []byte
+		verified     bool
+	}{
+		{"assertion", authenticatorData("example.com", AuthFlagUserPresent|AuthFlagUserVerified, 42, nil, nil), false, AuthFlagUserPresent | AuthFlagUserVerified, 42, "", nil, true},
+		{"presence only", authenticatorData("example.com", AuthFlagUserPresent, 1, nil, nil), false, AuthFlagUserPresent, 1, "", nil, false},
+		{"verified without presence", authenticatorData("example.com", AuthFlagUserVerified, 1, nil, nil), false, AuthFlagUserVerified, 1, "", nil, false},
+		{"attested credential", attested, false, AuthFlagUserPresent | AuthFlagUserVerified | AuthFlagAttested, 7, "credential-id", coseKey, true},
+		{"extensions after key", withExtensions, false, AuthFlagUserPresent | AuthFlagAttested | AuthFlagExtensions, 1, "credential-id", coseKey, false},
+		{"too short", make([]byte, 36), true, 0, 0, "", nil, false},
+		{"attested without credential data", authenticatorData("example.com", AuthFlagAttested, 0, nil, nil), true, 0, 0, "", nil, false},
+		{"credential id longer than data", attested[:37+18+5], true, 0, 0, "", nil, false},
+		{"truncated public key", attested[:len(attested)-4], true, 0, 0, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ParseAuthenticatorData(tt.raw)
+			if tt.err {
+				if err == nil {
+					t.Fatal("ParseAuthenticatorData accepted malformed data")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAuthenticatorData error: %v", err)
+			}
+
+			if data.Flags != tt.flags || data.SignCount != tt.count {
+				t.Errorf("flags, count = %#x, %d, want %#x, %d", data.Flags, data.SignCount, tt.flags, tt.count)
+			}
+			if string(data.CredentialID) != tt.credentialID {
+				t.Errorf("credential ID = %q, want %q", data.CredentialID, tt.credentialID)
+			}
+			if string(data.PublicKey) != string(tt.publicKey) {
+				t.Errorf("public key = %x, want %x", data.PublicKey, tt.publicKey)
+			}
+			if data.UserVerified() != tt.verified {
+				t.Errorf("UserVerified = %v, want %v", data.UserVerified(), tt.verified)
+			}
+			if !data.CheckRPIDHash("example.com") || data.CheckRPIDHash("evil.example") {
+				t.Error("CheckRPIDHash did not match the RP ID")
+			}
+		})
+	}
+}
+
+func TestParseAttestationObject(t *testing.T) {
+	authData := authenticatorData("example.com", AuthFlagUserPresent, 0, nil, nil)
+
+	// {"fmt": "none", "attStmt": {}, "authData": authData}
+	object := []byte{0xa3, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0x67, 'a', 't', 't', 'S', 't', 'm', 't', 0xa0, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a'}
+	object = append(object, cborBytes(authData)...)
+
+	format, got, err := ParseAttestationObject(object)
+	if err != nil || format != "none" || string(got) != string(authData) {
+		t.Errorf("ParseAttestationObject = %q, %x, %v", format, got, err)
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"not a map", []byte{0x80}},
+		{"missing authData", []byte{0xa1, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'}},
+		{"authData is text", []byte{0xa1, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a', 0x61, 'x'}},
+		{"truncated", object[:len(object)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseAttestationObject(tt.raw); err == nil {
+				t.Error("ParseAttestationObject accepted malformed data")
+			}
+		})
+	}
+}
+
+func TestCOSEVerify(t *testing.T) {
+	message := []byte("authenticatorData || clientDataHash")
+
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	edKey := ed25519COSEKey(edPub)
+	edSig := ed25519.Sign(edPriv, message)
+
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecKey := es256COSEKey(&ecPriv.PublicKey)
+	digest := sha256.Sum256(message)
+	ecSig, _ := ecdsa.SignASN1(rand.Reader, ecPriv, digest[:])
+
+	// {1: 3 (RSA), 3: -257 (RS256)}，不受支持
+	rsaKey := []byte{0xa2, 0x01, 0x03, 0x03, 0x39, 0x01, 0x00}
+
+	tests := []struct {
+		name      string
+		key       []byte
+		signature []byte
+		alg       int64
+		keyErr    bool
+		verifyErr bool
+	}{
+		{"EdDSA", edKey, edSig, COSEAlgEdDSA, false, false},
+		{"ES256", ecKey, ecSig, COSEAlgES256, false, false},
+		{"EdDSA wrong signature", edKey, append([]byte{edSig[0] ^ 1}, edSig[1:]...), COSEAlgEdDSA, false, true},
+		{"ES256 with EdDSA signature", ecKey, edSig, COSEAlgES256, false, true},
+		{"unsupported algorithm", rsaKey, edSig, -257, true, true},
+		{"short Ed25519 key", ed25519COSEKey(edPub[:31]), edSig, COSEAlgEdDSA, true, true},
+		{"not a map", []byte{0x80}, edSig, 0, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, err := COSEAlgorithm(tt.key)
+			if (err != nil) != tt.keyErr || alg != tt.alg {
+				t.Errorf("COSEAlgorithm = %d, %v, want %d, error %v", alg, err, tt.alg, tt.keyErr)
+			}
+
+			if err := COSEVerify(tt.key, message, tt.signature); (err != nil) != tt.verifyErr {
+				t.Errorf("COSEVerify error = %v, want error %v", err, tt.verifyErr)
+			}
+		})
+	}
+}